@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Times each /benchmark-suite case is evaluated
+const benchmarkRuns = 100
+
+// Case of the benchmark suite: an expression and the variables it reads
+type benchmarkCase struct {
+	name string
+	expr string
+	vars map[string]int
+}
+
+// Letter-only variable name for i, like a, b, ..., z, ba, bb
+func benchmarkVarName(i int) string {
+	name := string(rune('a' + i%26))
+	for i /= 26; i > 0; i /= 26 {
+		name = string(rune('a'+i%26)) + name
+	}
+	return name
+}
+
+// The fixed cases of /benchmark-suite
+func benchmarkCases() []benchmarkCase {
+	terms := make([]string, 1000)
+	for i := range terms {
+		terms[i] = fmt.Sprint(i % 10)
+	}
+	vars := make(map[string]int)
+	names := make([]string, 500)
+	for i := range names {
+		names[i] = benchmarkVarName(i)
+		vars[names[i]] = i
+	}
+	return []benchmarkCase{
+		{"deep nesting", strings.Repeat("(", 200) + "1" + strings.Repeat("+1)", 200), nil},
+		{"long chain", strings.Join(terms, " + "), nil},
+		{"mixed operators", strings.Repeat("2 * 3 - 4 // 2 + 7 ^ 2 - ", 50) + "1", nil},
+		{"function calls", strings.Repeat("max(abs(-3), min(4, 5), clamp(9, 0, 8)) + ", 50) + "0", nil},
+		{"many variables", strings.Join(names, " + "), vars},
+	}
+}
+
+// Handle /benchmark-suite: evaluate each built-in case benchmarkRuns
+// times, folding constants as evaluate does, and report the time per
+// case and in total. Variables of the suite live in their own scope.
+func benchmarkSuite(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("Usage: /benchmark-suite")
+	}
+	var total time.Duration
+	for _, c := range benchmarkCases() {
+		sc := &scope{vars: c.vars, parent: globalScope}
+		start := time.Now()
+		for i := 0; i < benchmarkRuns; i++ {
+			if _, err := evaluateIn(c.expr, sc); err != nil {
+				return fmt.Errorf("%s: %v", c.name, err)
+			}
+		}
+		elapsed := time.Since(start)
+		total += elapsed
+		fmt.Fprintf(out, "%-16s %v\n", c.name, elapsed)
+	}
+	fmt.Fprintf(out, "%-16s %v\n", "total", total)
+	return nil
+}
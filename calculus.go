@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Evaluate postfix with name bound to x, leaving the variable itself alone
+func evaluateAt(postfix []string, name string, x int) (int, error) {
+	local := &scope{vars: map[string]int{name: x}, parent: globalScope}
+	return evaluatePostfixIn(postfix, local)
+}
+
+// Handle /diff <expr> <var>: the derivative of expr with respect to var
+// at its current value. Values are integers, so this is the central
+// difference (f(x+1) - f(x-1)) / 2 with step h = 1, which is exact for
+// polynomials up to degree 2.
+func derivative(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("Usage: /diff <expr> <var>")
+	}
+	expr, name := strings.Join(args[:len(args)-1], " "), args[len(args)-1]
+	x, ok := variables[name]
+	if !isValidIdentifier(name) || !ok {
+		return unknownVariableError{name}
+	}
+	postfix, err := infixToPostfix(expr)
+	if err != nil {
+		return fmt.Errorf("Invalid expression")
+	}
+	before, err := evaluateAt(postfix, name, x-1)
+	if err != nil {
+		return err
+	}
+	after, err := evaluateAt(postfix, name, x+1)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, formatDecimal(float64(after-before)/2, 2))
+	return nil
+}
+
+// Handle /integrate <expr> <var> <lo> <hi>: the definite integral of expr
+// from lo to hi. Values are integers, so expr is sampled at each integer
+// and combined with Simpson's rule, using the 3/8 rule for the last three
+// intervals when their count is odd. This is exact for cubic polynomials.
+func integrate(args []string) error {
+	if len(args) < 4 {
+		return fmt.Errorf("Usage: /integrate <expr> <var> <lo> <hi>")
+	}
+	n := len(args)
+	expr, name := strings.Join(args[:n-3], " "), args[n-3]
+	if !isValidIdentifier(name) {
+		return fmt.Errorf("Invalid identifier")
+	}
+	lo, err := evaluate(args[n-2])
+	if err != nil {
+		return err
+	}
+	hi, err := evaluate(args[n-1])
+	if err != nil {
+		return err
+	}
+	sign := 1.0
+	if lo > hi {
+		lo, hi, sign = hi, lo, -1
+	}
+	postfix, err := infixToPostfix(expr)
+	if err != nil {
+		return fmt.Errorf("Invalid expression")
+	}
+	// Add up weighted samples as they come, without keeping them. The
+	// span is unsigned so that even the widest range does not overflow.
+	intervals := uint64(hi) - uint64(lo)
+	even := intervals
+	if intervals > 1 && intervals%2 == 1 {
+		even -= 3
+	}
+	area := 0.0
+	x := lo
+	for k := uint64(0); ; k++ {
+		if err := checkTimeout(); err != nil {
+			return err
+		}
+		y, err := evaluateAt(postfix, name, x)
+		if err != nil {
+			return err
+		}
+		area += simpsonWeight(k, intervals, even) * float64(y)
+		if k == intervals {
+			break // hi may be the largest int
+		}
+		x++
+	}
+	fmt.Fprintln(out, formatDecimal(sign*area, 2))
+	return nil
+}
+
+// Weight of sample k of n+1 in the composite rule of integrate: Simpson's
+// rule over samples 0 to even, the 3/8 rule over the rest
+func simpsonWeight(k, n, even uint64) float64 {
+	switch n {
+	case 0:
+		return 0
+	case 1:
+		return 0.5
+	}
+	w := 0.0
+	switch {
+	case k > even:
+	case k == 0 || k == even:
+		w = 1.0 / 3
+	case k%2 == 1:
+		w = 4.0 / 3
+	default:
+		w = 2.0 / 3
+	}
+	if k >= even && even < n {
+		if k == even || k == n {
+			w += 3.0 / 8
+		} else {
+			w += 9.0 / 8
+		}
+	}
+	return w
+}
@@ -0,0 +1,792 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Handle a command line starting with "/"
+func handleCommand(line string) error {
+	fields := strings.Fields(line)
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case "/help":
+		return showHelp(args)
+	case "/watch":
+		return addWatch(strings.TrimSpace(strings.TrimPrefix(line, name)))
+	case "/whatis":
+		return whatis(args)
+	case "/autosave":
+		return setAutosave(args)
+	case "/benchmark-suite":
+		return benchmarkSuite(args)
+	case "/check":
+		return check(strings.TrimSpace(strings.TrimPrefix(line, name)))
+	case "/color":
+		return setColor(args)
+	case "/const":
+		return defineConstant(strings.TrimSpace(strings.TrimPrefix(line, name)))
+	case "/convert":
+		if len(args) == 3 {
+			return convertUnits(args)
+		}
+		return convertBase(args)
+	case "/data":
+		return data(args)
+	case "/decimals":
+		if len(args) != 1 || (args[0] != "full" && args[0] != "auto") {
+			return fmt.Errorf("Usage: /decimals full|auto")
+		}
+		fullDecimals = args[0] == "full"
+		return nil
+	case "/def":
+		return defineFunction(strings.TrimSpace(strings.TrimPrefix(line, name)))
+	case "/define-op":
+		return defineOperator(strings.TrimSpace(strings.TrimPrefix(line, name)))
+	case "/diff":
+		return derivative(args)
+	case "/dump":
+		return dump(args)
+	case "/exact":
+		return setExact(args)
+	case "/factor":
+		return factor(args)
+	case "/last-error":
+		return showLastError()
+	case "/limit":
+		return setLimit(args)
+	case "/finance":
+		return setFinance(args)
+	case "/get":
+		return get(args)
+	case "/graph":
+		return graph(args)
+	case "/import":
+		return importModule(args)
+	case "/integrate":
+		return integrate(args)
+	case "/lint":
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			return fmt.Errorf("Usage: /lint on|off")
+		}
+		lintMode = args[0] == "on"
+		return nil
+	case "/load":
+		return load(args)
+	case "/locale":
+		if _, ok := locales[strings.Join(args, " ")]; len(args) != 1 || !ok {
+			return fmt.Errorf("Usage: /locale plain|us|de")
+		}
+		locale = args[0]
+		return nil
+	case "/macro":
+		return macro(args)
+	case "/mode":
+		if len(args) != 1 || (args[0] != "math" && args[0] != "c") {
+			return fmt.Errorf("Usage: /mode math|c")
+		}
+		operatorMode = args[0]
+		return nil
+	case "/nesting":
+		return setNesting(args)
+	case "/pctchange":
+		return percentChange(args)
+	case "/redo":
+		if lastExpression == "" {
+			return fmt.Errorf("No previous expression")
+		}
+		return processLine(lastExpression)
+	case "/precision-guard":
+		return setPrecisionGuard(args)
+	case "/profile":
+		return profile(strings.TrimSpace(strings.TrimPrefix(line, name)))
+	case "/rcl":
+		return recall(args)
+	case "/rounding":
+		return setRounding(args)
+	case "/rpn":
+		return setRPN(args)
+	case "/rpn-stack":
+		return showRPNStack()
+	case "/set":
+		return set(args)
+	case "/steps":
+		return showSteps(strings.TrimSpace(strings.TrimPrefix(line, name)))
+	case "/sto":
+		return store(args)
+	case "/strict":
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			return fmt.Errorf("Usage: /strict on|off")
+		}
+		strictMode = args[0] == "on"
+		return nil
+	case "/symbolic":
+		return setSymbolic(args)
+	case "/time":
+		fmt.Fprintln(out, time.Now().Format("2006-01-02 15:04:05 MST"))
+		return nil
+	case "/timeout":
+		return setTimeout(args)
+	case "/toinfix":
+		return toInfix(strings.TrimSpace(strings.TrimPrefix(line, name)))
+	case "/topostfix":
+		return toPostfix(strings.TrimSpace(strings.TrimPrefix(line, name)))
+	case "/unwatch":
+		return removeWatch(args)
+	case "/vars":
+		return listVariables(args)
+	}
+	return fmt.Errorf("Unknown command")
+}
+
+// Describe what a name refers to
+func whatis(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: /whatis <name>")
+	}
+	name := args[0]
+	if uf, ok := userFunctions[name]; ok {
+		fmt.Fprintf(out, "user function %s(%s) = %s\n", name, strings.Join(uf.params, ", "), uf.body)
+	} else if f, ok := functions[name]; ok {
+		fmt.Fprintln(out, "built-in function", f.usage)
+	} else if isSpecialForm(name) {
+		fmt.Fprintln(out, "built-in function", specialForms[name].usage)
+	} else if val, ok := constants[name]; ok {
+		fmt.Fprintf(out, "constant = %d\n", val)
+	} else if val, ok := variables[name]; ok {
+		fmt.Fprintf(out, "variable = %d\n", val)
+	} else if l, ok := labels[strings.Trim(name, "[]")]; ok {
+		fmt.Fprintf(out, "label = %s (%d)\n", l.expr, l.value)
+	} else if n := registerIndex(name); n >= 0 {
+		fmt.Fprintf(out, "register = %d\n", registers[n])
+	} else {
+		fmt.Fprintln(out, "undefined")
+	}
+	return nil
+}
+
+// Help text for each /help topic
+var helpTopics = map[string][]string{
+	"operators": {
+		"Binary operators: + - * / ^ (power, right-associative).",
+		"** is power as well. In /mode c, ^ is bitwise XOR instead and binds",
+		"looser than comparisons as in C, so use ** for powers there.",
+		"/ truncates toward zero (-7 / 2 is -3), // rounds down (-7 // 2 is -4).",
+		"a mod b is the remainder of a // b, binding like * (-7 mod 3 is 2).",
+		"mod is reserved, so it cannot name a variable or function.",
+		"Unary minus and plus: -x, +x. Note that -2^2 is -(2^2).",
+		"~x is the bitwise complement of x and binds like unary minus: ~5 is -6.",
+		"√x is the square root of x rounded down and binds like unary minus:",
+		"√16 is 4, √(3+1) is 2, √10 is 3 and 2√9 is an error, write 2*√9.",
+		"n! is the factorial of n and binds tightest, so -3! is -(3!) and",
+		"2^3! is 2^(3!). Write (3!) == 6, as 3!=6 reads as 3 != 6.",
+		"A whole line n! is printed in full even past 20!, up to 10000!, but",
+		"inside a larger expression n! must fit into an integer.",
+		"With /finance on, n% is relative to the left operand of its operator:",
+		"100 + 10% is 110, 100 - 20% is 80, 200 * 10% is 20, 50 / 10% is 500.",
+		"Elsewhere n% is n / 100. Without /finance, % is not an operator.",
+		"Comparisons: == != < > <= >= give 1 for true and 0 for false.",
+		"They bind looser than arithmetic, so x > 0 + 1 is x > (0 + 1).",
+		"Parentheses ( ) group, |x| is the absolute value of x.",
+		"x |> f is f(x) and x |> f(a) is f(x, a), so 16 |> abs |> sign is",
+		"sign(abs(16)). The pipe binds loosest: 1 - 3 |> abs is abs(1 - 3).",
+		"1+1, 2*2 evaluates each expression and prints 2 4 on one line.",
+		"A trailing ; as in 2 + 2; computes a line without printing it. It does",
+		"not separate statements, a; b is an error.",
+		"Integer numbers, digits may be grouped like 1_000_000.",
+	},
+	"variables": {
+		"Assign with name = expression, names consist of letters only.",
+		"Several at once: a, b = 1, 2 (a, b = b, a swaps).",
+		"name := expression declares a new variable and fails if it exists.",
+		"x += 1 updates x, as do -= *= /= //= ^= and **=. An undefined x",
+		"counts as 0 and is created, unless /strict is on (it is off by default).",
+		"With /strict on, = only updates variables that already exist.",
+		"x = 5  # radius attaches the note radius to x, shown by /vars.",
+		"A # after white space starts a comment on any line.",
+		"Type a variable name to print its value.",
+		"print \"label\", expr, ... prints text and values on one line.",
+		"total: expr prints expr and keeps its value as [total] for later lines.",
+		"expr => name prints the value of expr and also assigns it to name.",
+	},
+	"commands": {
+		"/help [topic]         show help",
+		"/whatis <name>        describe a name, also written name?",
+		"/autosave on <file>   write variables to file after every change",
+		"/autosave off         stop writing them",
+		"/benchmark-suite      time a fixed set of expressions",
+		"/check <expr>         check syntax without evaluating",
+		"/color on|off         colored results and errors",
+		"/const name = <expr>  define a constant that cannot be changed",
+		"/convert <n> <base>   print n in a base from 2 to 36",
+		"/convert <n> <from> <to>",
+		"                      convert units: mm cm m km in ft yd mi,",
+		"                      mg g kg t oz lb, and c f k for temperature",
+		"/data on|off          enter values for statistics, one per line",
+		"/data count|sum|mean|stddev",
+		"                      statistics of the values, stddev of the population",
+		"/data clear           forget the values",
+		"/decimals full|auto   all digits or rounded decimals",
+		"/def f(x) = <expr>    define a function",
+		"/define-op <sym> precedence <n> = <expr>",
+		"                      define a binary operator on a and b, n from 1 to 6",
+		"                      symbols that read as built-ins, like <- (< -), are refused",
+		"/diff <expr> <var>    derivative of expr at the current value of var",
+		"/dump <file>          write assignments recreating all variables",
+		"/exact on|off         print inexact divisions as fractions like 3 1/2",
+		"/factor <n>           prime factorization of n",
+		"/finance on|off       100 + 10% is 110, see /help operators",
+		"/get <name>           print a setting",
+		"/graph <expr> <var> <lo> <hi>",
+		"                      plot expr as var runs from lo to hi",
+		"/import <module>      run definitions from module.calc on $SMARTCALC_PATH",
+		"/integrate <expr> <var> <lo> <hi>",
+		"                      definite integral of expr from lo to hi",
+		"/last-error           show the most recent error again",
+		"/limit [n]            most lines a macro may run",
+		"/lint on|off          warn about redundant parentheses",
+		"/load [merge|replace] <file>",
+		"                      read variables written by /dump",
+		"/locale plain|us|de   result format: 1234.5, 1,234.5 or 1.234,5",
+		"/macro record <name>  store the following lines as a macro",
+		"/macro stop           stop recording",
+		"/macro play <name>    run the lines of a macro",
+		"/mode math|c          ^ as power (math) or as bitwise XOR (c)",
+		"/nesting [n]          deepest nesting of parentheses allowed",
+		"/pctchange <old> <new>",
+		"                      percentage change from old to new",
+		"/precision-guard on|off",
+		"                      warn when / drops a remainder or a result overflows",
+		"/profile <expr>       time spent tokenizing, parsing, folding constants",
+		"                      and evaluating",
+		"/quiet                in a script, print nothing until /verbose",
+		"/rcl <n>              print register n, also readable as rn",
+		"/redo                 evaluate the last expression again",
+		"/rounding [mode]      half-up, banker or truncate for decimals",
+		"/rpn [on|off]         postfix input like 3 4 + with a kept stack",
+		"                      tokens need spaces; -4 is negative, neg negates",
+		"/rpn-stack            show the RPN stack",
+		"/set [<name> <value>] change a setting, or list all of them",
+		"/steps <expr>         show each operation as it is computed",
+		"/sto <n>              store the last result in register 0-9",
+		"/strict on|off        require := to create variables",
+		"/symbolic on|off      print expressions with undefined variables as",
+		"                      formulas like 2 * x + 3 instead of failing",
+		"/time                 print the current time",
+		"/timeout [seconds]    time limit for one line, 0 for none",
+		"/toinfix <postfix>    infix form of postfix like 2 3 4 * +",
+		"/topostfix <expr>     postfix form of expr, without evaluating it",
+		"                      calls read name#argc as in max#3, prefix operators",
+		"                      u- u+ u~ u√, and special form arguments [ ... ]",
+		"/unwatch <name>       stop watching",
+		"/vars [pattern]       list variables, or those matching a glob like t*",
+		"/vars count           number of variables and their rough memory use",
+		"/vars sort value      list variables by value, largest first",
+		"/verbose              in a script, print output again after /quiet",
+		"/watch name = <expr>  print expr again whenever a variable in it changes",
+		"/cancel               drop an expression continued over lines",
+		"/exit                 quit",
+	},
+}
+
+// Print help for a topic, or list the topics
+func showHelp(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(out, "The program supports +, -, *, /, ^ and parentheses ().")
+		fmt.Fprintln(out, "It also supports variables, functions and unary minus and plus.")
+		fmt.Fprintln(out, "Help topics: commands, functions, operators, variables (/help <topic>).")
+		return nil
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("Usage: /help [topic]")
+	}
+
+	topic := args[0]
+	if topic == "functions" {
+		usages := make([]string, 0, len(functions)+len(specialForms))
+		for _, f := range functions {
+			usages = append(usages, f.usage)
+		}
+		for _, f := range specialForms {
+			usages = append(usages, f.usage)
+		}
+		sort.Strings(usages)
+		for _, usage := range usages {
+			fmt.Fprintln(out, usage)
+		}
+		return nil
+	}
+	lines, ok := helpTopics[topic]
+	if !ok {
+		return fmt.Errorf("Unknown help topic")
+	}
+	for _, line := range lines {
+		fmt.Fprintln(out, line)
+	}
+	return nil
+}
+
+// Turn colored output on or off
+func setColor(args []string) error {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		return fmt.Errorf("Usage: /color on|off")
+	}
+	useColor = args[0] == "on"
+	return nil
+}
+
+// Variable names in alphabetical order
+func sortedVariableNames() []string {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Handle /const name = expr. A constant is defined once and cannot be
+// redefined, nor share its name with a variable.
+func defineConstant(def string) error {
+	name, expr, found := strings.Cut(def, "=")
+	name = strings.TrimSpace(name)
+	if !found || !isValidIdentifier(name) {
+		return fmt.Errorf("Usage: /const name = expression")
+	}
+	if _, ok := constants[name]; ok {
+		return fmt.Errorf("Constant already defined: %s", name)
+	}
+	if _, ok := variables[name]; ok {
+		return fmt.Errorf("Variable already defined: %s", name)
+	}
+	val, err := evaluate(strings.TrimSpace(expr))
+	if err != nil {
+		return err
+	}
+	constants[name] = val
+	return nil
+}
+
+// Write a script of assignments that recreates the current variables
+func dump(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: /dump <file>")
+	}
+	return writeVariables(args[0])
+}
+
+// Write all variables to a file as name = value lines, sorted by name
+func writeVariables(path string) error {
+	var sb strings.Builder
+	for _, name := range sortedVariableNames() {
+		fmt.Fprintf(&sb, "%s = %d\n", name, variables[name])
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("Cannot write file")
+	}
+	return nil
+}
+
+// File the variables are written to after every change, empty if off
+var autosaveFile = ""
+
+// Handle /autosave on <file> and /autosave off
+func setAutosave(args []string) error {
+	if len(args) == 1 && args[0] == "off" {
+		autosaveFile = ""
+		return nil
+	}
+	if len(args) != 2 || args[0] != "on" {
+		return fmt.Errorf("Usage: /autosave on <file> or /autosave off")
+	}
+	autosaveFile = args[1]
+	autosave()
+	return nil
+}
+
+// Write the variables to the autosave file, if any. A failed write only
+// warns, the change itself stays.
+func autosave() {
+	if autosaveFile == "" {
+		return
+	}
+	if err := writeVariables(autosaveFile); err != nil {
+		printError(fmt.Errorf("Warning: cannot autosave to %s", autosaveFile))
+	}
+}
+
+// Print a non-negative number in another base
+func convertBase(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("Usage: /convert <n> <base> or /convert <n> <from> <to>")
+	}
+	n, err := evaluate(args[0])
+	if err != nil {
+		return err
+	}
+	base, err := evaluate(args[1])
+	if err != nil {
+		return err
+	}
+	if base < 2 || base > 36 {
+		return fmt.Errorf("Base must be between 2 and 36")
+	}
+	if n < 0 {
+		return fmt.Errorf("Number must not be negative")
+	}
+	fmt.Fprintln(out, strconv.FormatInt(int64(n), base))
+	return nil
+}
+
+// Read variables from a file of name = value lines, as written by /dump.
+// In merge mode (the default) loaded values overwrite variables with the
+// same name and other variables are kept; replace mode drops all current
+// variables first. Nothing changes if the file cannot be read completely.
+func load(args []string) error {
+	mode := "merge"
+	if len(args) == 2 {
+		mode = args[0]
+		args = args[1:]
+	}
+	if len(args) != 1 || (mode != "merge" && mode != "replace") {
+		return fmt.Errorf("Usage: /load [merge|replace] <file>")
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("Cannot open file")
+	}
+	loaded := make(map[string]int)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		val, err := parseNumber(strings.TrimSpace(value))
+		if !found || !isValidIdentifier(name) || err != nil {
+			return fmt.Errorf("Invalid file format")
+		}
+		if err := checkNotConstant(name); err != nil {
+			return err
+		}
+		loaded[name] = val
+	}
+
+	if mode == "replace" {
+		clear(variables)
+		clear(notes)
+	}
+	for name, val := range loaded {
+		variables[name] = val
+	}
+	variablesChanged()
+	return nil
+}
+
+// Directories searched by /import when SMARTCALC_PATH is not set
+func defaultModulePath() []string {
+	dirs := []string{"."}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".smartcalc", "modules"))
+	}
+	return dirs
+}
+
+// Modules whose import is in progress, to stop import cycles
+var importing = make(map[string]bool)
+
+// Handle /import <module>: run the lines of the first <module>.calc found
+// in the directories of SMARTCALC_PATH, e.g. a geometry.calc of /def lines
+func importModule(args []string) error {
+	if len(args) != 1 || !isValidIdentifier(args[0]) {
+		return fmt.Errorf("Usage: /import <module>")
+	}
+	name := args[0]
+	if importing[name] {
+		return fmt.Errorf("Module %s imports itself", name)
+	}
+	dirs := defaultModulePath()
+	if env := os.Getenv("SMARTCALC_PATH"); env != "" {
+		dirs = filepath.SplitList(env)
+	}
+	for _, dir := range dirs {
+		f, err := os.Open(filepath.Join(dir, name+".calc"))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+		importing[name] = true
+		defer delete(importing, name)
+		if run(f, false) {
+			return fmt.Errorf("Errors in module %s", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("Module not found: %s", name)
+}
+
+// Print the percentage change from old to new, relative to the size of
+// old so that going from -100 to -50 is an increase of 50%
+func percentChange(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("Usage: /pctchange <old> <new>")
+	}
+	from, err := evaluate(args[0])
+	if err != nil {
+		return err
+	}
+	to, err := evaluate(args[1])
+	if err != nil {
+		return err
+	}
+	if from == 0 {
+		return fmt.Errorf("Division by zero")
+	}
+	pct := float64(to-from) / math.Abs(float64(from)) * 100
+	fmt.Fprintln(out, formatDecimal(pct, 2)+"%")
+	return nil
+}
+
+// Evaluate an expression and report how long each phase took:
+// tokenizing, parsing to postfix, folding constants and evaluating
+func profile(expr string) error {
+	if expr == "" {
+		return fmt.Errorf("Usage: /profile <expr>")
+	}
+	start := time.Now()
+	tokens, err := expressionTokens(expr)
+	if err != nil {
+		return fmt.Errorf("Invalid expression")
+	}
+	tokenized := time.Now()
+	postfix, err := postfixFromTokens(tokens)
+	if err != nil {
+		return fmt.Errorf("Invalid expression")
+	}
+	parsed := time.Now()
+	postfix = foldConstants(postfix)
+	folded := time.Now()
+	val, err := evaluatePostfix(postfix)
+	if err != nil {
+		return err
+	}
+	evaluated := time.Now()
+
+	printResult(val)
+	recordResult(val)
+	fmt.Fprintf(out, "tokenize  %v\n", tokenized.Sub(start))
+	fmt.Fprintf(out, "parse     %v\n", parsed.Sub(tokenized))
+	fmt.Fprintf(out, "fold      %v\n", folded.Sub(parsed))
+	fmt.Fprintf(out, "evaluate  %v\n", evaluated.Sub(folded))
+	return nil
+}
+
+// Report whether an expression is well-formed without evaluating it.
+// Variables need not be defined.
+func check(expr string) error {
+	postfix, err := infixToPostfix(expr)
+	if err != nil {
+		return err
+	}
+	if err := checkPostfix(postfix); err != nil {
+		return err
+	}
+	fmt.Fprintln(out, "OK")
+	return nil
+}
+
+// Check that every operator and function call in postfix has its operands
+func checkPostfix(postfix []string) error {
+	depth := 0 // number of values on the stack during evaluation
+	for i := 0; i < len(postfix); i++ {
+		token := postfix[i]
+		if token == "[" {
+			end := matchingBracket(postfix, i)
+			if err := checkPostfix(postfix[i+1 : end]); err != nil {
+				return err
+			}
+			i = end
+		} else if isNumber(token) || isValueName(token) {
+			depth++
+		} else if name, argc, ok := parseFuncToken(token); ok {
+			if err := checkArity(name, argc); err != nil {
+				return err
+			}
+			// Special form arguments are checked above and not on the stack
+			if isSpecialForm(name) {
+				depth++
+			} else {
+				depth = depth - argc + 1
+			}
+		} else if token == "u-" || token == "u+" || token == "u~" || token == "u√" || token == "!" || token == "%" {
+			if depth < 1 {
+				return fmt.Errorf("Missing operand")
+			}
+		} else {
+			if depth < 2 {
+				return fmt.Errorf("Missing operand")
+			}
+			depth--
+		}
+	}
+	if depth == 0 {
+		return fmt.Errorf("Empty expression")
+	}
+	if depth > 1 {
+		return fmt.Errorf("Missing operator")
+	}
+	return nil
+}
+
+// Show or set the rounding mode for decimal output
+func setRounding(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(out, roundingMode)
+		return nil
+	}
+	if len(args) != 1 || !slices.Contains(roundingModes, args[0]) {
+		return fmt.Errorf("Usage: /rounding half-up|banker|truncate")
+	}
+	roundingMode = args[0]
+	return nil
+}
+
+// Print the prime factorization of a positive number, like 2^3 * 3^2 * 5.
+// 1 has no prime factors and prints as 1.
+func factor(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: /factor <n>")
+	}
+	n, err := evaluate(args[0])
+	if err != nil {
+		return err
+	}
+	if n < 1 {
+		return fmt.Errorf("Number must be positive")
+	}
+	if n == 1 {
+		fmt.Fprintln(out, 1)
+		return nil
+	}
+
+	factors := []string{}
+	addFactor := func(p, count int) {
+		if count == 1 {
+			factors = append(factors, strconv.Itoa(p))
+		} else {
+			factors = append(factors, fmt.Sprintf("%d^%d", p, count))
+		}
+	}
+	for p := 2; p <= n/p; p++ {
+		if p%(1<<20) == 0 {
+			if err := checkTimeout(); err != nil {
+				return err
+			}
+		}
+		count := 0
+		for n%p == 0 {
+			n /= p
+			count++
+		}
+		if count > 0 {
+			addFactor(p, count)
+		}
+	}
+	if n > 1 {
+		addFactor(n, 1)
+	}
+	fmt.Fprintln(out, strings.Join(factors, " * "))
+	return nil
+}
+
+// Print a variable for /vars, with its note if it has one
+func printVariable(name string) {
+	if note, ok := notes[name]; ok {
+		fmt.Fprintf(out, "%s = %d  # %s\n", name, variables[name], note)
+		return
+	}
+	fmt.Fprintf(out, "%s = %d\n", name, variables[name])
+}
+
+// List variables in alphabetical order, only those whose name matches a
+// glob pattern like temp* if one is given. /vars count prints how many
+// there are instead, /vars sort value lists them largest value first.
+func listVariables(args []string) error {
+	if len(args) == 2 && args[0] == "sort" && args[1] == "value" {
+		names := sortedVariableNames()
+		// Stable, so equal values stay in name order
+		sort.SliceStable(names, func(i, j int) bool {
+			return variables[names[i]] > variables[names[j]]
+		})
+		for _, name := range names {
+			printVariable(name)
+		}
+		return nil
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("Usage: /vars [pattern|count|sort value]")
+	}
+	if len(args) == 1 && args[0] == "count" {
+		// Rough size: the name, its string header, the value and map overhead
+		bytes := 0
+		for name := range variables {
+			bytes += len(name) + 32
+		}
+		fmt.Fprintf(out, "%d variables, about %d bytes\n", len(variables), bytes)
+		return nil
+	}
+	pattern := "*"
+	if len(args) == 1 {
+		pattern = args[0]
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("Invalid pattern")
+	}
+	for _, name := range sortedVariableNames() {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			printVariable(name)
+		}
+	}
+	return nil
+}
+
+// Show or set the deepest nesting of parentheses with /nesting [n]
+func setNesting(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(out, maxNesting)
+		return nil
+	}
+	n, err := parseNumber(args[0])
+	if len(args) != 1 || err != nil || n < 1 {
+		return fmt.Errorf("Nesting depth must be a positive integer")
+	}
+	maxNesting = n
+	return nil
+}
+
+// Show or set the evaluation time limit in seconds
+func setTimeout(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(out, int(evalTimeout/time.Second))
+		return nil
+	}
+	seconds, err := parseNumber(args[0])
+	if len(args) != 1 || err != nil || seconds < 0 {
+		return fmt.Errorf("Timeout must be a non-negative number of seconds")
+	}
+	if int64(seconds) > int64(math.MaxInt64/time.Second) {
+		return fmt.Errorf("Timeout must be at most %d seconds", int64(math.MaxInt64/time.Second))
+	}
+	evalTimeout = time.Duration(seconds) * time.Second
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Values of constant subexpressions seen this session, keyed by their
+// postfix tokens as written
+var constantCache = make(map[string]int)
+
+// Most entries kept in constantCache, and the longest subexpression, in
+// tokens, worth remembering
+const (
+	maxConstantCache  = 1000
+	maxConstantTokens = 1000
+)
+
+// Built-in functions whose value can change between calls
+var impureFunctions = []string{"now", "prev"}
+
+// Part of a postfix expression that leaves one value on the stack, as
+// the span postfix[start:end]
+type operand struct {
+	start, end int
+	constant   bool
+}
+
+// Replace each largest subexpression made only of numbers, operators and
+// pure built-in functions by its value, computing every distinct one once
+// per session. Anything involving a variable is left alone, as are
+// subexpressions that fail so that their error shows up when evaluated.
+func foldConstants(postfix []string) []string {
+	// Special form arguments are evaluated by the form itself
+	if slices.Contains(postfix, "[") {
+		return postfix
+	}
+	stack := []operand{}
+	spans := []operand{} // largest constant subexpressions
+	for i, token := range postfix {
+		argc, constant := 0, true
+		switch {
+		case isNumber(token):
+		case isValueName(token):
+			constant = false
+		case token == "u-" || token == "u+" || token == "u~" || token == "u√" || token == "!" || token == "%":
+			argc = 1
+		default:
+			if name, n, ok := parseFuncToken(token); ok {
+				_, user := userFunctions[name]
+				argc, constant = n, !user && !slices.Contains(impureFunctions, name)
+			} else {
+				// Custom operators can be redefined and read variables
+				argc, constant = 2, !isCustomOperator(token)
+			}
+		}
+		if len(stack) < argc {
+			// Malformed, leave it to the evaluator to report
+			return postfix
+		}
+		args := stack[len(stack)-argc:]
+		stack = stack[:len(stack)-argc]
+		for _, arg := range args {
+			constant = constant && arg.constant
+		}
+		if !constant {
+			for _, arg := range args {
+				if arg.constant {
+					spans = append(spans, arg)
+				}
+			}
+		}
+		start := i
+		if argc > 0 {
+			start = args[0].start
+		}
+		stack = append(stack, operand{start, i + 1, constant})
+	}
+	if len(stack) != 1 {
+		return postfix
+	}
+	if stack[0].constant {
+		spans = append(spans, stack[0])
+	}
+	slices.SortFunc(spans, func(a, b operand) int { return a.start - b.start })
+
+	// Splice the value of each span into a copy of postfix
+	folded := make([]string, 0, len(postfix))
+	done := 0
+	for _, span := range spans {
+		if span.end-span.start == 1 {
+			continue
+		}
+		if val, ok := constantValue(postfix[span.start:span.end]); ok {
+			folded = append(folded, postfix[done:span.start]...)
+			folded = append(folded, strconv.Itoa(val))
+			done = span.end
+		}
+	}
+	return append(folded, postfix[done:]...)
+}
+
+// Value of a constant postfix expression, from the cache if possible
+func constantValue(postfix []string) (int, bool) {
+	key := ""
+	if len(postfix) <= maxConstantTokens {
+		key = strings.Join(postfix, " ")
+		if val, ok := constantCache[key]; ok {
+			return val, true
+		}
+	}
+	warnings := len(precisionWarnings)
+	val, err := evaluatePostfix(postfix)
+	if err != nil {
+		return 0, false
+	}
+	// Keep lossy results uncached so that they warn every time
+	if len(precisionWarnings) == warnings && key != "" && len(constantCache) < maxConstantCache {
+		constantCache[key] = val
+	}
+	return val, true
+}
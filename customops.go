@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Binary operator defined with /define-op, its body reading operands a, b
+type customOperator struct {
+	prec int
+	fn   userFunction
+}
+
+var customOperators = make(map[string]customOperator)
+
+// Symbols of the custom operators, longest first like symbolTokens
+var customSymbols = []string{}
+
+// Characters custom operator symbols may be made of
+const customOperatorChars = "!$%&*+-./<>@^|~"
+
+// Handle /define-op <symbol> precedence <n> = <expr>, e.g.
+// /define-op <> precedence 3 = max(a, b). The left operand is a and the
+// right one b; n ranges from 1 to 6 on the scale of the built-in
+// operators: 2 for comparisons, 3 for + -, 4 for * /, 6 for ^.
+func defineOperator(def string) error {
+	head, body, found := strings.Cut(def, "=")
+	fields := strings.Fields(head)
+	body = strings.TrimSpace(body)
+	if !found || len(fields) != 3 || fields[1] != "precedence" || body == "" {
+		return fmt.Errorf("Usage: /define-op <symbol> precedence <n> = <expr>")
+	}
+	symbol := fields[0]
+	for _, r := range symbol {
+		if !strings.ContainsRune(customOperatorChars, r) {
+			return fmt.Errorf("Invalid operator symbol: %s", symbol)
+		}
+	}
+	if slices.Contains(symbolTokens, symbol) {
+		return fmt.Errorf("Cannot redefine built-in operator %s", symbol)
+	}
+	if conflictsWithBuiltin(symbol) {
+		return fmt.Errorf("Operator %s conflicts with built-in operators", symbol)
+	}
+	prec, err := strconv.Atoi(fields[2])
+	if err != nil || prec < 1 || prec > precedence("^") {
+		return fmt.Errorf("Precedence must be from 1 to %d", precedence("^"))
+	}
+
+	fn := userFunction{params: []string{"a", "b"}, body: body}
+	postfix, err := infixToPostfix(body)
+	if err != nil {
+		return fmt.Errorf("Invalid expression")
+	}
+	fn.postfix = postfix
+	if _, ok := customOperators[symbol]; !ok {
+		customSymbols = append(customSymbols, symbol)
+		slices.SortStableFunc(customSymbols, func(x, y string) int { return len(y) - len(x) })
+	}
+	customOperators[symbol] = customOperator{prec, fn}
+	return nil
+}
+
+// Check if symbol could already occur in valid input. Custom symbols are
+// matched first, so <- would otherwise turn x<-1 from x < -1 into x <- 1.
+// The symbol is read as built-in tokens; it conflicts if it is a prefix
+// of one, or if those tokens can stand next to each other: a sign or ~
+// after an operator, anything after a postfix ! or %, and abs bars.
+func conflictsWithBuiltin(symbol string) bool {
+	for _, sym := range symbolTokens {
+		if strings.HasPrefix(sym, symbol) {
+			return true
+		}
+	}
+	parts := []string{}
+	for rest := symbol; rest != ""; {
+		part := ""
+		for _, sym := range symbolTokens {
+			if strings.HasPrefix(rest, sym) {
+				part = sym
+				break
+			}
+		}
+		if part == "" {
+			// $ & @ . never occur in valid input
+			return false
+		}
+		parts = append(parts, part)
+		rest = rest[len(part):]
+	}
+	if parts[0] == "!" || parts[0] == "%" {
+		return true
+	}
+	for i, part := range parts {
+		if part == "|" || (i > 0 && (part == "-" || part == "+" || part == "~")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if token is a custom operator
+func isCustomOperator(token string) bool {
+	_, ok := customOperators[token]
+	return ok
+}
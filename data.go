@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// While data entry is on, each input line is a value for the series
+var dataMode = false
+
+// Values entered for /data statistics, separate from variables
+var dataSeries = []int{}
+
+// Handle /data on|off|clear|count|sum|mean|stddev
+func data(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: /data on|off|clear|count|sum|mean|stddev")
+	}
+	switch args[0] {
+	case "on", "off":
+		dataMode = args[0] == "on"
+		return nil
+	case "clear":
+		dataSeries = dataSeries[:0]
+		return nil
+	case "count":
+		fmt.Fprintln(out, len(dataSeries))
+		return nil
+	case "sum":
+		sum := 0
+		for _, val := range dataSeries {
+			sum += val
+		}
+		printResult(sum)
+		return nil
+	case "mean", "stddev":
+		if len(dataSeries) == 0 {
+			return fmt.Errorf("No data")
+		}
+		mean, deviation := dataStatistics()
+		if args[0] == "mean" {
+			fmt.Fprintln(out, formatDecimal(mean, 2))
+		} else {
+			fmt.Fprintln(out, formatDecimal(deviation, 2))
+		}
+		return nil
+	}
+	return fmt.Errorf("Usage: /data on|off|clear|count|sum|mean|stddev")
+}
+
+// Mean and population standard deviation of the data series
+func dataStatistics() (float64, float64) {
+	n := float64(len(dataSeries))
+	sum := 0.0
+	for _, val := range dataSeries {
+		sum += float64(val)
+	}
+	mean := sum / n
+	squares := 0.0
+	for _, val := range dataSeries {
+		squares += (float64(val) - mean) * (float64(val) - mean)
+	}
+	return mean, math.Sqrt(squares / n)
+}
+
+// Add the value of an input line to the data series
+func addData(line string) error {
+	val, err := evaluate(line)
+	if err != nil {
+		return err
+	}
+	dataSeries = append(dataSeries, val)
+	return nil
+}
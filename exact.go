@@ -0,0 +1,85 @@
+package main
+
+import "fmt"
+
+// In exact mode an expression ending in an inexact division prints as a
+// fraction, like 3 1/2 for 7 / 2, instead of the truncated quotient
+var exactMode = false
+
+// Handle /exact on|off
+func setExact(args []string) error {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		return fmt.Errorf("Usage: /exact on|off")
+	}
+	exactMode = args[0] == "on"
+	return nil
+}
+
+// Greatest common divisor of a and b, which must not both be 0
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Change to the postfix stack made by token: values pushed minus popped
+func stackEffect(token string) int {
+	if name, argc, ok := parseFuncToken(token); ok && !isSpecialForm(name) {
+		return 1 - argc
+	}
+	switch {
+	case isNumber(token) || isValueName(token):
+		return 1
+	case token == "u-" || token == "u+" || token == "u~" || token == "u√" || token == "!" || token == "%":
+		return 0
+	}
+	return -1
+}
+
+// If the last operation of expr is a division that does not come out
+// even, print its value as a fraction and report true. The value kept
+// for prev() is still the truncated quotient.
+func printExact(expr string) (bool, error) {
+	postfix, err := infixToPostfix(expr)
+	if err != nil || len(postfix) < 3 || postfix[len(postfix)-1] != "/" {
+		return false, nil
+	}
+	// The divisor is the shortest tail before "/" that leaves one value
+	k, depth := len(postfix)-1, 0
+	for depth < 1 && k > 0 {
+		k--
+		if postfix[k] == "]" || postfix[k] == "[" {
+			return false, nil
+		}
+		depth += stackEffect(postfix[k])
+	}
+	if depth != 1 || k == 0 {
+		return false, nil
+	}
+	num, err := evaluatePostfix(postfix[:k])
+	if err != nil {
+		return true, err
+	}
+	den, err := evaluatePostfix(postfix[k : len(postfix)-1])
+	if err != nil {
+		return true, err
+	}
+	if den == 0 {
+		return true, fmt.Errorf("Division by zero")
+	}
+	if num%den == 0 {
+		return false, nil
+	}
+	g := gcd(num, den)
+	num, den = num/g, den/g
+	if den < 0 {
+		num, den = -num, -den
+	}
+	printFraction(num, den)
+	recordResult(num / den)
+	return true, nil
+}
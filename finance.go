@@ -0,0 +1,36 @@
+package main
+
+import "fmt"
+
+// In finance mode a trailing % is relative to the left operand, so
+// 100 + 10% is 110 and 100 - 20% is 80
+var financeMode = false
+
+// Handle /finance on|off
+func setFinance(args []string) error {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		return fmt.Errorf("Usage: /finance on|off")
+	}
+	financeMode = args[0] == "on"
+	return nil
+}
+
+// Merge each percent with the operator applying it, as in 100 10 % +
+// becoming 100 10 +%. A percent not followed by an operator stays as
+// the unary %, which divides by 100.
+func mergePercents(postfix []string) []string {
+	result := []string{}
+	for i := 0; i < len(postfix); i++ {
+		token := postfix[i]
+		if token == "%" && i+1 < len(postfix) {
+			switch next := postfix[i+1]; next {
+			case "+", "-", "*", "/":
+				result = append(result, next+"%")
+				i++
+				continue
+			}
+		}
+		result = append(result, token)
+	}
+	return result
+}
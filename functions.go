@@ -0,0 +1,389 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Built-in function with its allowed number of arguments
+type function struct {
+	minArgs int
+	maxArgs int    // -1 means any number of arguments
+	usage   string // signature and short description for /help
+	call    func(args []int) (int, error)
+}
+
+var functions = map[string]function{
+	"abs": {1, 1, "abs(x)  absolute value, also written |x|", func(args []int) (int, error) {
+		if args[0] < 0 {
+			return -args[0], nil
+		}
+		return args[0], nil
+	}},
+	// clamp(x, lo, hi) limits x to [lo, hi]; lo greater than hi is an error
+	"clamp": {3, 3, "clamp(x, lo, hi)  x limited to the range lo..hi", func(args []int) (int, error) {
+		x, lo, hi := args[0], args[1], args[2]
+		if lo > hi {
+			return 0, fmt.Errorf("Invalid range")
+		}
+		return min(max(x, lo), hi), nil
+	}},
+	"isprime": {1, 1, "isprime(n)  1 if n is a prime number, otherwise 0", func(args []int) (int, error) {
+		prime, err := isPrime(args[0])
+		return boolToInt(prime), err
+	}},
+	"max": {1, -1, "max(a, b, ...)  largest argument", func(args []int) (int, error) {
+		res := args[0]
+		for _, a := range args[1:] {
+			if a > res {
+				res = a
+			}
+		}
+		return res, nil
+	}},
+	"min": {1, -1, "min(a, b, ...)  smallest argument", func(args []int) (int, error) {
+		res := args[0]
+		for _, a := range args[1:] {
+			if a < res {
+				res = a
+			}
+		}
+		return res, nil
+	}},
+	// now() is the current Unix timestamp in seconds
+	"now": {0, 0, "now()  current Unix timestamp in seconds", func(args []int) (int, error) {
+		return int(time.Now().Unix()), nil
+	}},
+	"prev": {1, 1, "prev(n)  n-th previous result, prev(1) is the last one", func(args []int) (int, error) {
+		n := args[0]
+		if n < 1 || n > len(results) {
+			return 0, fmt.Errorf("No such previous result")
+		}
+		return results[len(results)-n], nil
+	}},
+	"sign": {1, 1, "sign(x)  -1, 0 or 1 depending on the sign of x", func(args []int) (int, error) {
+		switch {
+		case args[0] < 0:
+			return -1, nil
+		case args[0] > 0:
+			return 1, nil
+		}
+		return 0, nil
+	}},
+}
+
+// Special form: a function receiving its arguments unevaluated, as
+// postfix expressions, so it can decide which of them to evaluate
+type specialForm struct {
+	minArgs int
+	maxArgs int // -1 means any number of arguments
+	usage   string
+	call    func(args [][]string, sc *scope) (int, error)
+}
+
+var specialForms map[string]specialForm
+
+// Special forms evaluate expressions themselves, so they are registered at
+// init time to avoid an initialization cycle with the evaluator
+func init() {
+	specialForms = map[string]specialForm{
+		// coalesce(a, b, ...) is the first argument whose variables are all defined
+		"coalesce": {2, -1, "coalesce(a, b, ...)  first argument not using undefined variables", func(args [][]string, sc *scope) (int, error) {
+			for _, arg := range args[:len(args)-1] {
+				val, err := evaluatePostfixIn(arg, sc)
+				var unknown unknownVariableError
+				if !errors.As(err, &unknown) {
+					return val, err
+				}
+			}
+			return evaluatePostfixIn(args[len(args)-1], sc)
+		}},
+		"prod": {3, 4, "prod(i, lo, hi, expr)  product of expr for i from lo to hi", func(args [][]string, sc *scope) (int, error) {
+			return reduceRange(args, sc, 1, func(acc, val int) int { return acc * val })
+		}},
+		"sum": {3, 4, "sum(i, lo, hi, expr)  sum of expr for i from lo to hi", func(args [][]string, sc *scope) (int, error) {
+			return reduceRange(args, sc, 0, func(acc, val int) int { return acc + val })
+		}},
+	}
+}
+
+// Fold expr over the index variable i running from lo to hi inclusive, for
+// sum(i, lo, hi, expr) and prod(i, lo, hi, expr). Without expr the index
+// itself is folded, so sum(i, 1, 10) is 55. The index lives in its own
+// scope and never touches a global of the same name. A range with hi
+// below lo is empty and gives the start value.
+func reduceRange(args [][]string, sc *scope, start int, fold func(acc, val int) int) (int, error) {
+	if len(args[0]) != 1 || !isValidIdentifier(args[0][0]) {
+		return 0, fmt.Errorf("Index must be a variable name")
+	}
+	index := args[0][0]
+	lo, err := evaluatePostfixIn(args[1], sc)
+	if err != nil {
+		return 0, err
+	}
+	hi, err := evaluatePostfixIn(args[2], sc)
+	if err != nil {
+		return 0, err
+	}
+	body := args[0]
+	if len(args) == 4 {
+		body = args[3]
+	}
+
+	local := &scope{vars: make(map[string]int), parent: sc}
+	acc := start
+	for i := lo; i <= hi; i++ {
+		local.vars[index] = i
+		val, err := evaluatePostfixIn(body, local)
+		if err != nil {
+			return 0, err
+		}
+		acc = fold(acc, val)
+		if i == hi {
+			break // hi may be the largest int
+		}
+	}
+	return acc, nil
+}
+
+// Check if name is a special form
+func isSpecialForm(name string) bool {
+	_, ok := specialForms[name]
+	return ok
+}
+
+// Call a special form after checking its arity
+func callSpecialForm(name string, args [][]string, sc *scope) (int, error) {
+	if err := checkArity(name, len(args)); err != nil {
+		return 0, err
+	}
+	return specialForms[name].call(args, sc)
+}
+
+// Largest n whose factorial is printed in full, about 35660 digits
+const maxBigFactorial = 10000
+
+// Compute n! exactly as a big.Int
+func bigFactorial(n int) (*big.Int, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("Factorial of a negative number")
+	}
+	if n > maxBigFactorial {
+		return nil, errNumberRange
+	}
+	return new(big.Int).MulRange(1, int64(n)), nil
+}
+
+// Compute n!, reporting a range error instead of wrapping around once
+// the product no longer fits into int: past 20! on 64-bit platforms and
+// 12! on 32-bit ones
+func factorial(n int) (int, error) {
+	if n < 0 {
+		return 0, fmt.Errorf("Factorial of a negative number")
+	}
+	product := 1
+	for i := 2; i <= n; i++ {
+		if product > math.MaxInt/i {
+			return 0, errNumberRange
+		}
+		product *= i
+	}
+	return product, nil
+}
+
+// If expr is n! as a whole and too large for int, print its exact value
+// and report true. Such results are not kept for prev().
+func printBigFactorial(expr string) (bool, error) {
+	postfix, err := infixToPostfix(expr)
+	if err != nil || len(postfix) < 2 || postfix[len(postfix)-1] != "!" {
+		return false, nil
+	}
+	n, err := evaluatePostfix(postfix[:len(postfix)-1])
+	if err != nil {
+		return true, err
+	}
+	product, err := bigFactorial(n)
+	if err != nil {
+		return true, err
+	}
+	printText(localize(product.String()))
+	return true, nil
+}
+
+// Compute the square root of n >= 0 rounded down, exactly even where
+// float64 cannot represent n
+func isqrt(n int) int {
+	return int(new(big.Int).Sqrt(big.NewInt(int64(n))).Int64())
+}
+
+// Check if n is prime by trial division up to its square root
+func isPrime(n int) (bool, error) {
+	if n < 2 {
+		return false, nil
+	}
+	for d := 2; d <= n/d; d++ {
+		if n%d == 0 {
+			return false, nil
+		}
+		// Large primes take long, so look at the clock now and then
+		if d%(1<<20) == 0 {
+			if err := checkTimeout(); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// Most recent results printed at the prompt, oldest first
+var results = []int{}
+
+// Number of results kept for prev()
+const maxResults = 100
+
+// Remember a printed result for prev()
+func recordResult(val int) {
+	results = append(results, val)
+	if len(results) > maxResults {
+		results = results[len(results)-maxResults:]
+	}
+}
+
+// Function defined with /def
+type userFunction struct {
+	params  []string
+	body    string
+	postfix []string
+}
+
+var userFunctions = make(map[string]userFunction)
+
+// Deepest nesting of user function calls, to stop endless recursion
+const maxCallDepth = 1000
+
+// Current nesting of user function calls
+var callDepth = 0
+
+// Check if name is a built-in or user-defined function
+func isFunction(name string) bool {
+	if _, ok := functions[name]; ok {
+		return true
+	}
+	if isSpecialForm(name) {
+		return true
+	}
+	_, ok := userFunctions[name]
+	return ok
+}
+
+// Postfix token for a call of name with argc arguments, e.g. "max#3"
+func funcToken(name string, argc int) string {
+	return name + "#" + strconv.Itoa(argc)
+}
+
+// Split a postfix function call token into name and argument count
+func parseFuncToken(token string) (string, int, bool) {
+	name, count, found := strings.Cut(token, "#")
+	if !found || !isFunction(name) {
+		return "", 0, false
+	}
+	argc, err := strconv.Atoi(count)
+	if err != nil {
+		return "", 0, false
+	}
+	return name, argc, true
+}
+
+// Check that a call of function name has an allowed number of arguments
+func checkArity(name string, argc int) error {
+	minArgs, maxArgs := 0, -1
+	if uf, ok := userFunctions[name]; ok {
+		minArgs, maxArgs = len(uf.params), len(uf.params)
+	} else if f, ok := functions[name]; ok {
+		minArgs, maxArgs = f.minArgs, f.maxArgs
+	} else if f, ok := specialForms[name]; ok {
+		minArgs, maxArgs = f.minArgs, f.maxArgs
+	}
+	if argc < minArgs || (maxArgs >= 0 && argc > maxArgs) {
+		return fmt.Errorf("Wrong number of arguments")
+	}
+	return nil
+}
+
+// Call a function after checking its arity
+func callFunction(name string, args []int) (int, error) {
+	if uf, ok := userFunctions[name]; ok {
+		return callUserFunction(uf, args)
+	}
+	if err := checkArity(name, len(args)); err != nil {
+		return 0, err
+	}
+	return functions[name].call(args)
+}
+
+// Evaluate the body of a user function. Parameters live in a local scope
+// that shadows global variables of the same name; any other variable in
+// the body is looked up in the globals.
+func callUserFunction(uf userFunction, args []int) (int, error) {
+	if len(args) != len(uf.params) {
+		return 0, fmt.Errorf("Wrong number of arguments")
+	}
+	if callDepth >= maxCallDepth {
+		return 0, fmt.Errorf("Recursion too deep")
+	}
+	local := &scope{vars: make(map[string]int), parent: globalScope}
+	for i, param := range uf.params {
+		local.vars[param] = args[i]
+	}
+	callDepth++
+	defer func() { callDepth-- }()
+	return evaluatePostfixIn(uf.postfix, local)
+}
+
+// Define a user function from text like "f(x, y) = x + y"
+func defineFunction(def string) error {
+	head, body, found := strings.Cut(def, "=")
+	name, params, ok := strings.Cut(strings.TrimSpace(head), "(")
+	name = strings.TrimSpace(name)
+	params, closed := strings.CutSuffix(strings.TrimSpace(params), ")")
+	if !found || !ok || !closed || !isValidIdentifier(name) {
+		return fmt.Errorf("Usage: /def name(params) = expression")
+	}
+	if _, builtin := functions[name]; builtin || isSpecialForm(name) {
+		return fmt.Errorf("Cannot redefine built-in function")
+	}
+
+	uf := userFunction{body: strings.TrimSpace(body)}
+	if strings.TrimSpace(params) != "" {
+		for _, param := range strings.Split(params, ",") {
+			param = strings.TrimSpace(param)
+			if !isValidIdentifier(param) || slices.Contains(uf.params, param) {
+				return fmt.Errorf("Invalid parameter")
+			}
+			uf.params = append(uf.params, param)
+		}
+	}
+
+	// Register the name before parsing the body so it can call itself,
+	// and restore the previous definition if the body is invalid
+	previous, existed := userFunctions[name]
+	userFunctions[name] = uf
+	postfix, err := infixToPostfix(uf.body)
+	if err != nil || uf.body == "" {
+		if existed {
+			userFunctions[name] = previous
+		} else {
+			delete(userFunctions, name)
+		}
+		return fmt.Errorf("Invalid expression")
+	}
+	uf.postfix = foldConstants(postfix)
+	userFunctions[name] = uf
+	return nil
+}
@@ -0,0 +1,3 @@
+module smart-calculator
+
+go 1.22
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Most columns and rows of a /graph plot
+const (
+	graphWidth  = 40
+	graphHeight = 20
+)
+
+// Handle /graph <expr> <var> <lo> <hi>: plot expr as var runs from lo to
+// hi. The variable is bound only while plotting, like the index of sum().
+func graph(args []string) error {
+	if len(args) < 4 {
+		return fmt.Errorf("Usage: /graph <expr> <var> <lo> <hi>")
+	}
+	n := len(args)
+	expr, name := strings.Join(args[:n-3], " "), args[n-3]
+	if !isValidIdentifier(name) {
+		return fmt.Errorf("Invalid identifier")
+	}
+	lo, err := evaluate(args[n-2])
+	if err != nil {
+		return err
+	}
+	hi, err := evaluate(args[n-1])
+	if err != nil {
+		return err
+	}
+	if lo >= hi {
+		return fmt.Errorf("Invalid range")
+	}
+	postfix, err := infixToPostfix(expr)
+	if err != nil {
+		return fmt.Errorf("Invalid expression")
+	}
+
+	// Sample every integer of small ranges, graphWidth points otherwise.
+	// Spans are unsigned so that even -1 to the largest int fits.
+	span := uint64(hi) - uint64(lo)
+	columns := graphWidth
+	if span < graphWidth {
+		columns = int(span) + 1
+	}
+	xs := make([]int, columns)
+	ys := make([]int, columns)
+	local := &scope{vars: make(map[string]int), parent: globalScope}
+	for i := range xs {
+		xs[i] = int(uint64(lo) + scale(span, uint64(i), uint64(columns-1)))
+		local.vars[name] = xs[i]
+		if ys[i], err = evaluatePostfixIn(postfix, local); err != nil {
+			return err
+		}
+	}
+	ymin, ymax := ys[0], ys[0]
+	for _, y := range ys {
+		ymin, ymax = min(ymin, y), max(ymax, y)
+	}
+
+	yspan := uint64(ymax) - uint64(ymin)
+	rows := graphHeight
+	if yspan < graphHeight {
+		rows = int(yspan) + 1
+	}
+	// Row of each sample, 0 at the top
+	row := func(y int) int {
+		if rows == 1 {
+			return 0
+		}
+		return int(scale(uint64(ymax)-uint64(y), uint64(rows-1), yspan))
+	}
+	top, bottom := strconv.Itoa(ymax), strconv.Itoa(ymin)
+	labelWidth := max(len(top), len(bottom))
+	for r := 0; r < rows; r++ {
+		label := ""
+		if r == 0 {
+			label = top
+		} else if r == rows-1 {
+			label = bottom
+		}
+		line := []byte(strings.Repeat(" ", columns))
+		for i, y := range ys {
+			if row(y) == r {
+				line[i] = '*'
+			}
+		}
+		fmt.Fprintf(out, "%*s |%s\n", labelWidth, label, strings.TrimRight(string(line), " "))
+	}
+	fmt.Fprintf(out, "%*s +%s\n", labelWidth, "", strings.Repeat("-", columns))
+	from, to := strconv.Itoa(lo), strconv.Itoa(hi)
+	gap := max(columns-len(from)-len(to), 1)
+	fmt.Fprintf(out, "%*s  %s%s%s\n", labelWidth, "", from, strings.Repeat(" ", gap), to)
+	return nil
+}
+
+// Compute x * i / n for i <= n without overflowing the product
+func scale(x, i, n uint64) uint64 {
+	hi, lo := bits.Mul64(x, i)
+	q, _ := bits.Div64(hi, lo, n)
+	return q
+}
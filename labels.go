@@ -0,0 +1,45 @@
+package main
+
+import "strings"
+
+// Result of a labelled line like total: 1 + 2 + 3, read back as [total]
+type label struct {
+	expr  string
+	value int
+}
+
+// Labelled results by name
+var labels = make(map[string]label)
+
+// Split a line like total: 1 + 2 into label and expression. The := of
+// declarations does not start a label.
+func splitLabel(line string) (string, string, bool) {
+	name, expr, found := strings.Cut(line, ":")
+	name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+	if !found || !isValidIdentifier(name) || expr == "" || strings.HasPrefix(expr, "=") {
+		return "", "", false
+	}
+	return name, expr, true
+}
+
+// Name of a label reference like [total], if token is one
+func labelReference(token string) (string, bool) {
+	name, ok := strings.CutPrefix(token, "[")
+	if !ok {
+		return "", false
+	}
+	name, ok = strings.CutSuffix(name, "]")
+	return name, ok && isValidIdentifier(name)
+}
+
+// Evaluate a labelled expression, print its value and keep both
+func handleLabel(name, expr string) error {
+	val, err := evaluate(expr)
+	if err != nil {
+		return err
+	}
+	labels[name] = label{expr, val}
+	printResult(val)
+	recordResult(val)
+	return nil
+}
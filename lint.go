@@ -0,0 +1,98 @@
+package main
+
+import "strings"
+
+// Warn about redundant parentheses after evaluating an expression
+var lintMode = false
+
+// Print a warning for each parenthesized group that does not change how
+// the expression is grouped, like ((2+3)) or (5)
+func lint(expr string) {
+	tokens, err := expressionTokens(expr)
+	if err != nil {
+		return
+	}
+	for _, group := range redundantParens(tokens) {
+		printInfo("Warning: redundant parentheses " + strings.Join(tokens[group[0]:group[1]+1], "") + "\n")
+	}
+}
+
+// Find the start and end index of each redundant parenthesized group.
+// Parentheses of function calls are never redundant.
+func redundantParens(tokens []string) [][2]int {
+	unary := make([]bool, len(tokens))
+	for i, token := range tokens {
+		if token == "~" || token == "√" {
+			unary[i] = true
+		} else if token == "-" || token == "+" {
+			unary[i] = i == 0 || tokens[i-1] == "(" || tokens[i-1] == "," || isOperator(tokens[i-1]) || unary[i-1]
+		}
+	}
+	// Binding strength of the operator at i, 0 if it is not one
+	strength := func(i int) int {
+		if i < 0 || i >= len(tokens) {
+			return 0
+		}
+		if unary[i] {
+			return precedence("u-")
+		}
+		if tokens[i] == "!" || tokens[i] == "%" {
+			return precedence("^") + 1
+		}
+		if isOperator(tokens[i]) {
+			return precedence(tokens[i])
+		}
+		return 0
+	}
+
+	groups := [][2]int{}
+	open := []int{}
+	for j, token := range tokens {
+		if token == "(" {
+			open = append(open, j)
+			continue
+		}
+		if token != ")" || len(open) == 0 {
+			continue
+		}
+		i := open[len(open)-1]
+		open = open[:len(open)-1]
+		if i > 0 && isValidIdentifier(tokens[i-1]) {
+			continue
+		}
+		// Loosest operator directly inside the group; a lone operand
+		// binds tighter than any operator
+		inner := precedence("^") + 1
+		depth := 0
+		for k := i + 1; k < j; k++ {
+			switch tokens[k] {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			default:
+				if s := strength(k); depth == 0 && s > 0 && s < inner {
+					inner = s
+				}
+			}
+		}
+		left, right := strength(i-1), strength(j+1)
+		redundant := inner > left && inner > right
+		// (a - b) - c groups like a - b - c, and a ^ (b ^ c) like a ^ b ^ c
+		if inner > left && inner == right && !isRightAssociative(tokens[j+1]) && !unary[j+1] {
+			redundant = true
+		}
+		if inner == left && inner > right && isRightAssociative(tokens[i-1]) {
+			redundant = true
+		}
+		// Of doubled parentheses only the outer pair is reported
+		if i > 0 && tokens[i-1] == "(" && j+1 < len(tokens) && tokens[j+1] == ")" &&
+			!(i > 1 && isValidIdentifier(tokens[i-2])) {
+			redundant = false
+		}
+		if redundant {
+			groups = append(groups, [2]int{i, j})
+		}
+	}
+	return groups
+}
@@ -0,0 +1,78 @@
+package main
+
+import "fmt"
+
+// Recorded macros: name to input lines
+var macros = make(map[string][]string)
+
+// Name of the macro being recorded, empty if not recording
+var recordingMacro = ""
+
+// Macros currently being played, to refuse recursive playback
+var playingMacros = make(map[string]bool)
+
+// Most lines one macro playback may run, including nested macros
+var iterationLimit = 1_000_000
+
+// Lines run by the current top-level playback
+var iterations = 0
+
+// Handle /macro record <name>, /macro stop and /macro play <name>
+func macro(args []string) error {
+	if len(args) == 1 && args[0] == "stop" {
+		if recordingMacro == "" {
+			return fmt.Errorf("Not recording a macro")
+		}
+		recordingMacro = ""
+		return nil
+	}
+	if len(args) != 2 || !isValidIdentifier(args[1]) {
+		return fmt.Errorf("Usage: /macro record|play <name> or /macro stop")
+	}
+
+	name := args[1]
+	switch args[0] {
+	case "record":
+		recordingMacro = name
+		macros[name] = []string{}
+		return nil
+	case "play":
+		lines, ok := macros[name]
+		if !ok {
+			return fmt.Errorf("Unknown macro")
+		}
+		if playingMacros[name] {
+			return fmt.Errorf("Recursive macro")
+		}
+		if len(playingMacros) == 0 {
+			iterations = 0
+		}
+		playingMacros[name] = true
+		defer delete(playingMacros, name)
+		for _, line := range lines {
+			iterations++
+			if iterations > iterationLimit {
+				return fmt.Errorf("Iteration limit exceeded")
+			}
+			if err := processLine(line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Usage: /macro record|play <name> or /macro stop")
+}
+
+// Show or set the iteration limit with /limit [n]
+func setLimit(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(out, iterationLimit)
+		return nil
+	}
+	n, err := parseNumber(args[0])
+	if len(args) != 1 || err != nil || n < 1 {
+		return fmt.Errorf("Limit must be a positive integer")
+	}
+	iterationLimit = n
+	return nil
+}
@@ -2,24 +2,60 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"math"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 	"unicode"
+	"unicode/utf8"
 )
 
 var variables = make(map[string]int)
 
+// Notes attached to variables by a comment on their assignment
+var notes = make(map[string]string)
+
+// Constants defined with /const, which cannot be assigned to
+var constants = make(map[string]int)
+
+// Error for assigning to a name defined with /const
+func checkNotConstant(name string) error {
+	if _, ok := constants[name]; ok {
+		return fmt.Errorf("Cannot assign to constant: %s", name)
+	}
+	return nil
+}
+
+// Operator syntax: "math" reads ^ as power, "c" reads it as bitwise XOR
+var operatorMode = "math"
+
+// Longest input line accepted, in bytes
+const maxLineLength = 16 * 1024 * 1024
+
 // Operator precedence
 func precedence(op string) int {
+	if c, ok := customOperators[op]; ok {
+		return c.prec
+	}
 	switch op {
 	case "^":
+		return 6
+	case "u-", "u+", "u~", "u√":
+		return 5
+	case "*", "/", "//", "mod", "*%", "/%":
+		return 4
+	case "+", "-", "+%", "-%":
 		return 3
-	case "*", "/":
+	case "==", "!=", "<", ">", "<=", ">=":
 		return 2
-	case "+", "-":
+	case "⊕":
 		return 1
 	}
 	return 0
@@ -27,11 +63,19 @@ func precedence(op string) int {
 
 // Associativity: true if right-associative
 func isRightAssociative(op string) bool {
-	return op == "^"
+	return op == "^" || op == "u-" || op == "u+" || op == "u~" || op == "u√"
+}
+
+// Check if binary operator token
+func isOperator(token string) bool {
+	return precedence(token) > 0 && token != "u-" && token != "u+" && token != "u~" && token != "u√"
 }
 
-// Check if valid identifier
+// Check if valid identifier. The operator keyword mod is reserved.
 func isValidIdentifier(s string) bool {
+	if s == "mod" {
+		return false
+	}
 	for _, r := range s {
 		if !unicode.IsLetter(r) {
 			return false
@@ -40,42 +84,256 @@ func isValidIdentifier(s string) bool {
 	return len(s) > 0
 }
 
+// Check if a name that reads as a value: a variable, a register or a
+// label reference
+func isValueName(s string) bool {
+	_, isLabel := labelReference(s)
+	return isValidIdentifier(s) || registerIndex(s) >= 0 || isLabel
+}
+
+// Variable scope: its own values first, then those of the enclosing scope
+type scope struct {
+	vars   map[string]int
+	parent *scope
+}
+
+// Scope of the variables assigned at the prompt
+var globalScope = &scope{vars: variables}
+
+// Look up a variable along the scope chain
+func (s *scope) lookup(name string) (int, bool) {
+	for ; s != nil; s = s.parent {
+		if val, ok := s.vars[name]; ok {
+			return val, true
+		}
+	}
+	return 0, false
+}
+
+// Error for a variable that has no value
+type unknownVariableError struct {
+	name string
+}
+
+func (e unknownVariableError) Error() string {
+	return "Unknown variable: " + e.name
+}
+
 // Resolve value: number or variable
-func resolveValue(token string) (int, error) {
+func resolveValue(token string, sc *scope) (int, error) {
 	if isNumber(token) {
-		return strconv.Atoi(token)
+		return parseNumber(token)
 	}
-	if isValidIdentifier(token) {
-		val, ok := variables[token]
+	if name, ok := labelReference(token); ok {
+		l, ok := labels[name]
 		if !ok {
-			return 0, fmt.Errorf("Unknown variable")
+			return 0, fmt.Errorf("Unknown label: %s", name)
+		}
+		return l.value, nil
+	}
+	if isValueName(token) {
+		val, ok := sc.lookup(token)
+		if !ok {
+			if val, ok := constants[token]; ok {
+				return val, nil
+			}
+			// Registers r0 to r9 contain a digit, so no variable can hide them
+			if n := registerIndex(token); n >= 0 {
+				return registers[n], nil
+			}
+			return 0, unknownVariableError{token}
 		}
 		return val, nil
 	}
 	return 0, fmt.Errorf("Invalid identifier")
 }
 
-// Check if number
+// Most parentheses an expression may nest, |x| and function calls included
+var maxNesting = 256
+
+// Error for expressions nested deeper than maxNesting
+var errTooDeeplyNested = errors.New("Expression too deeply nested")
+
+// Error for integer literals that do not fit into int
+var errNumberRange = errors.New("Number out of range")
+
+// Check if number. Literals too large for int still count as numbers so
+// that evaluating them reports the range error instead of a syntax error.
 func isNumber(s string) bool {
-	_, err := strconv.Atoi(s)
-	return err == nil
+	_, err := parseNumber(s)
+	return err == nil || err == errNumberRange
+}
+
+// Parse integer literal. Like in Go, digits may be grouped with single
+// underscores between them (1_000_000), but not at either end or doubled.
+func parseNumber(s string) (int, error) {
+	if strings.Contains(s, "_") {
+		for i := 0; i < len(s); i++ {
+			if s[i] == '_' && (i == 0 || i == len(s)-1 || !isDigit(s[i-1]) || !isDigit(s[i+1])) {
+				return 0, fmt.Errorf("Invalid number")
+			}
+		}
+		s = strings.ReplaceAll(s, "_", "")
+	}
+	val, err := strconv.Atoi(s)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, errNumberRange
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Invalid number")
+	}
+	return val, nil
+}
+
+// Check if ASCII digit
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// Tokenize an expression with abs bars and operator spellings resolved
+func expressionTokens(expr string) ([]string, error) {
+	tokens, err := rewriteAbsBars(tokenize(expr))
+	if err != nil {
+		return nil, err
+	}
+	// ** is always power; in C mode ^ is bitwise XOR, written ⊕ in postfix
+	for i, token := range tokens {
+		if token == "^" && operatorMode == "c" {
+			tokens[i] = "⊕"
+		} else if token == "**" {
+			tokens[i] = "^"
+		}
+	}
+	return desugarPipes(tokens)
+}
+
+// Rewrite each x |> f into f(x) and x |> f(a, b) into f(x, a, b), leftmost
+// pipe first so that 16 |> abs |> sign is sign(abs(16)). The piped value
+// x is everything left of |> up to the start of the enclosing parentheses
+// or argument, so the pipe binds looser than any operator.
+func desugarPipes(tokens []string) ([]string, error) {
+	for {
+		p := slices.Index(tokens, "|>")
+		if p < 0 {
+			return tokens, nil
+		}
+		start := 0
+		depth := 0
+	scan:
+		for k := p - 1; k >= 0; k-- {
+			switch tokens[k] {
+			case ")":
+				depth++
+			case "(", ",":
+				if depth == 0 {
+					start = k + 1
+					break scan
+				}
+				if tokens[k] == "(" {
+					depth--
+				}
+			}
+		}
+		if start == p || p+1 >= len(tokens) || !isFunction(tokens[p+1]) {
+			return nil, fmt.Errorf("Invalid pipe")
+		}
+		name := tokens[p+1]
+		call := append([]string{name, "("}, tokens[start:p]...)
+		end := p + 2
+		if end < len(tokens) && tokens[end] == "(" {
+			// Find the closing parenthesis of the call's own arguments
+			depth := 0
+			for end < len(tokens) {
+				if tokens[end] == "(" {
+					depth++
+				} else if tokens[end] == ")" {
+					depth--
+				}
+				end++
+				if depth == 0 {
+					break
+				}
+			}
+			if depth != 0 {
+				return nil, fmt.Errorf("Missing closing parenthesis")
+			}
+			if args := tokens[p+3 : end-1]; len(args) > 0 {
+				call = append(append(call, ","), args...)
+			}
+		}
+		call = append(call, ")")
+		tokens = slices.Concat(tokens[:start], call, tokens[end:])
+	}
 }
 
 // Convert infix to postfix using Shunting Yard
 func infixToPostfix(expr string) ([]string, error) {
-	// Normalize operators like +++ or ---
-	expr = normalizeOperators(expr)
+	tokens, err := expressionTokens(expr)
+	if err != nil {
+		return nil, err
+	}
+	return postfixFromTokens(tokens)
+}
 
-	tokens := tokenize(expr)
+// Convert the tokens of an infix expression, as from expressionTokens,
+// to postfix
+func postfixFromTokens(tokens []string) ([]string, error) {
+	depth := 0
+	for _, token := range tokens {
+		if token == "(" {
+			depth++
+			if depth > maxNesting {
+				return nil, errTooDeeplyNested
+			}
+		} else if token == ")" {
+			depth--
+		}
+	}
 	output := []string{}
 	stack := []string{}
+	// Argument counts of the function calls currently open
+	argCounts := []int{}
 
-	for _, token := range tokens {
-		if isNumber(token) || isValidIdentifier(token) {
+	for i, token := range tokens {
+		if isFunction(token) && i+1 < len(tokens) && tokens[i+1] == "(" {
+			stack = append(stack, token)
+		} else if isNumber(token) || isValueName(token) {
 			output = append(output, token)
 		} else if token == "(" {
+			// Opening parenthesis of a function call starts counting arguments
+			if len(stack) > 0 && isFunction(stack[len(stack)-1]) {
+				if i+1 < len(tokens) && tokens[i+1] == ")" {
+					argCounts = append(argCounts, 0)
+				} else {
+					argCounts = append(argCounts, 1)
+					// Arguments of special forms are kept unevaluated in [ ]
+					if isSpecialForm(stack[len(stack)-1]) {
+						output = append(output, "[")
+					}
+				}
+			}
 			stack = append(stack, token)
+		} else if token == "," {
+			// Empty arguments like f(1,,2) or f(,1)
+			if i == 0 || tokens[i-1] == "(" || tokens[i-1] == "," {
+				return nil, fmt.Errorf("Empty function argument")
+			}
+			for len(stack) > 0 && stack[len(stack)-1] != "(" {
+				output = append(output, stack[len(stack)-1])
+				stack = stack[:len(stack)-1]
+			}
+			// Commas are only allowed directly inside a function call
+			if len(stack) < 2 || !isFunction(stack[len(stack)-2]) {
+				return nil, fmt.Errorf("Comma outside a function call")
+			}
+			if isSpecialForm(stack[len(stack)-2]) {
+				output = append(output, "]", "[")
+			}
+			argCounts[len(argCounts)-1]++
 		} else if token == ")" {
+			if i > 0 && tokens[i-1] == "," {
+				return nil, fmt.Errorf("Empty function argument")
+			}
 			foundLeft := false
 			for len(stack) > 0 {
 				top := stack[len(stack)-1]
@@ -87,13 +345,47 @@ func infixToPostfix(expr string) ([]string, error) {
 				output = append(output, top)
 			}
 			if !foundLeft {
-				return nil, fmt.Errorf("Invalid expression")
+				return nil, fmt.Errorf("Unmatched closing parenthesis")
 			}
-		} else if token == "+" || token == "-" || token == "*" || token == "/" || token == "^" {
-			// Invalid sequences of * or /
-			if strings.Contains(token, "**") || strings.Contains(token, "//") {
-				return nil, fmt.Errorf("Invalid expression")
+			// Closing parenthesis of a function call emits the call
+			if len(stack) > 0 && isFunction(stack[len(stack)-1]) {
+				name := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				argc := argCounts[len(argCounts)-1]
+				argCounts = argCounts[:len(argCounts)-1]
+				if isSpecialForm(name) && argc > 0 {
+					output = append(output, "]")
+				}
+				output = append(output, funcToken(name, argc))
+			}
+		} else if token == "!" || (token == "%" && financeMode) {
+			// Postfix factorial and percent bind tightest and apply to what
+			// precedes them
+			if i == 0 || !(isNumber(tokens[i-1]) || isValueName(tokens[i-1]) ||
+				tokens[i-1] == ")" || tokens[i-1] == "!" || tokens[i-1] == "%") {
+				return nil, fmt.Errorf("Invalid token: %s", token)
 			}
+			output = append(output, token)
+		} else if token == "~" || token == "√" {
+			// Bitwise NOT and square root are always prefix operators,
+			// binding like unary minus
+			if i > 0 && (isNumber(tokens[i-1]) || isValueName(tokens[i-1]) ||
+				tokens[i-1] == ")" || tokens[i-1] == "!" || tokens[i-1] == "%") {
+				return nil, fmt.Errorf("Invalid token: %s", token)
+			}
+			stack = append(stack, "u"+token)
+		} else if (token == "+" || token == "-") &&
+			(i == 0 || isOperator(tokens[i-1]) || tokens[i-1] == "(" || tokens[i-1] == "," || tokens[i-1] == "~" || tokens[i-1] == "√") {
+			// A sign is unary at the start, after an operator, "(", "," ~ or √,
+			// and binary after an operand. Unary signs bind tighter than *
+			// and / but looser than ^, on either side of it:
+			//   -5 is -5, 5 - -3 is 8, 2*-3 is -6, 2--3 is 2 - (-3)
+			//   -2^2 is -(2^2) = -4, (-2)^2 is 4, 2^-1 is 2^(-1)
+			stack = append(stack, "u"+token)
+		} else if isOperator(token) {
+			// Pop operators that bind tighter, and equally tight ones unless
+			// token is right-associative: 10 - 5 - 2 is (10 - 5) - 2 and
+			// 100 / 10 / 2 is (100 / 10) / 2, but 2 ^ 3 ^ 2 is 2 ^ (3 ^ 2)
 			for len(stack) > 0 {
 				top := stack[len(stack)-1]
 				if precedence(top) > precedence(token) ||
@@ -106,91 +398,191 @@ func infixToPostfix(expr string) ([]string, error) {
 			}
 			stack = append(stack, token)
 		} else {
-			return nil, fmt.Errorf("Invalid expression")
+			return nil, fmt.Errorf("Invalid token: %s", token)
 		}
 	}
 
 	for len(stack) > 0 {
 		top := stack[len(stack)-1]
 		stack = stack[:len(stack)-1]
-		if top == "(" || top == ")" {
-			return nil, fmt.Errorf("Invalid expression")
+		if top == "(" || top == ")" || isFunction(top) {
+			return nil, fmt.Errorf("Missing closing parenthesis")
 		}
 		output = append(output, top)
 	}
+	if financeMode {
+		output = mergePercents(output)
+	}
 	return output, nil
 }
 
+// Operator and punctuation tokens, two-character ones first so that
+// <= is not read as < followed by =
+var symbolTokens = []string{
+	"==", "!=", "<=", ">=", "//", "**", "|>",
+	"(", ")", "+", "-", "*", "/", "^", ",", "|", "<", ">", "=", "!", "%", "~", "√",
+}
+
 // Tokenize expression (split into numbers, variables, operators, parentheses)
+// in a single pass over the input. Any Unicode white space, tabs and
+// newlines included, only separates tokens, so 2\t+\t3 is 2 + 3. Operators
+// like // are matched on the raw input and cannot contain white space.
 func tokenize(expr string) []string {
-	// Add spaces around operators and parentheses
-	replacer := strings.NewReplacer(
-		"(", " ( ",
-		")", " ) ",
-		"+", " + ",
-		"-", " - ",
-		"*", " * ",
-		"/", " / ",
-		"^", " ^ ",
-	)
-	expr = replacer.Replace(expr)
-	return strings.Fields(expr)
-}
-
-// Normalize sequences of + and -
-func normalizeOperators(expr string) string {
-	// Replace sequences of + with single +
-	expr = strings.ReplaceAll(expr, "++", "+")
-	// Replace sequences of -- with +
-	for strings.Contains(expr, "--") {
-		expr = strings.ReplaceAll(expr, "--", "+")
-	}
-	// Replace sequences of +- or -+ with -
-	for strings.Contains(expr, "+-") {
-		expr = strings.ReplaceAll(expr, "+-", "-")
-	}
-	for strings.Contains(expr, "-+") {
-		expr = strings.ReplaceAll(expr, "-+", "-")
-	}
-	return expr
-}
-
-// Evaluate postfix expression
-func evaluatePostfix(postfix []string) (int, error) {
-	stack := []int{}
-	for _, token := range postfix {
-		if isNumber(token) || isValidIdentifier(token) {
-			val, err := resolveValue(token)
-			if err != nil {
-				return 0, err
+	tokens := []string{}
+	start := -1 // start of the current number or identifier, -1 if none
+
+	for i := 0; i < len(expr); {
+		r, size := utf8.DecodeRuneInString(expr[i:])
+		symbol := ""
+		// Custom operators go first, so <> is not read as < followed by >
+		for _, sym := range customSymbols {
+			if strings.HasPrefix(expr[i:], sym) {
+				symbol = sym
+				break
 			}
-			stack = append(stack, val)
-		} else {
-			if len(stack) < 2 {
-				return 0, fmt.Errorf("Invalid expression")
+		}
+		for _, sym := range symbolTokens {
+			if symbol != "" {
+				break
+			}
+			if strings.HasPrefix(expr[i:], sym) {
+				symbol = sym
+			}
+		}
+		if unicode.IsSpace(r) || symbol != "" {
+			if start >= 0 {
+				tokens = append(tokens, expr[start:i])
+				start = -1
+			}
+			if symbol != "" {
+				tokens = append(tokens, symbol)
+				size = len(symbol)
 			}
-			b := stack[len(stack)-1]
-			a := stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-			var res int
-			switch token {
-			case "+":
-				res = a + b
-			case "-":
-				res = a - b
-			case "*":
-				res = a * b
-			case "/":
-				if b == 0 {
-					return 0, fmt.Errorf("Division by zero")
+		} else if start < 0 {
+			start = i
+		}
+		i += size
+	}
+	if start >= 0 {
+		tokens = append(tokens, expr[start:])
+	}
+	return tokens
+}
+
+// Replace full-width forms like ２＋３, as pasted from some CJK
+// sources, with their ASCII counterparts
+func normalizeWidth(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '！' && r <= '～':
+			return r - '！' + '!'
+		case r == '\u3000':
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// Rewrite absolute value bars |x| into abs(x).
+// A bar right after a number, variable, ")" or closing bar closes the
+// innermost open bar; anywhere else it opens a new one. So ||x|| is
+// abs(abs(x)) and |a|*|b| is abs(a)*abs(b), while a bar closing across
+// parentheses like (|x)| is rejected. A |> that would close an open bar
+// is that bar followed by > or >=, so |-3|>0 compares rather than pipes.
+func rewriteAbsBars(tokens []string) ([]string, error) {
+	result := []string{}
+	// Open parentheses and bars, innermost last
+	groups := []string{}
+
+	// Check if a bar at i closes the innermost open bar by its position
+	closes := func(i int) bool {
+		if i == 0 || !(isNumber(tokens[i-1]) || isValueName(tokens[i-1]) ||
+			tokens[i-1] == ")" || tokens[i-1] == "|" || tokens[i-1] == "!" || tokens[i-1] == "%") {
+			return false
+		}
+		// A bar after a closing bar closes only if another bar is still open
+		return tokens[i-1] != "|" || result[len(result)-1] == ")"
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch token {
+		case "(":
+			groups = append(groups, "(")
+		case ")":
+			if len(groups) > 0 {
+				if groups[len(groups)-1] != "(" {
+					return nil, fmt.Errorf("Unmatched |")
 				}
-				res = a / b
-			case "^":
-				res = int(math.Pow(float64(a), float64(b)))
-			default:
+				groups = groups[:len(groups)-1]
+			}
+		case "|>":
+			if len(groups) > 0 && groups[len(groups)-1] == "|" && closes(i) {
+				groups = groups[:len(groups)-1]
+				result = append(result, ")")
+				if i+1 < len(tokens) && tokens[i+1] == "=" {
+					result = append(result, ">=")
+					i++
+				} else {
+					result = append(result, ">")
+				}
+				continue
+			}
+		case "|":
+			if closes(i) {
+				if len(groups) == 0 || groups[len(groups)-1] != "|" {
+					return nil, fmt.Errorf("Unmatched |")
+				}
+				groups = groups[:len(groups)-1]
+				result = append(result, ")")
+			} else {
+				groups = append(groups, "|")
+				result = append(result, "abs", "(")
+			}
+			continue
+		}
+		result = append(result, token)
+	}
+	return result, nil
+}
+
+// Evaluate postfix expression with the global variables
+func evaluatePostfix(postfix []string) (int, error) {
+	return evaluatePostfixIn(postfix, globalScope)
+}
+
+// Evaluate postfix expression, resolving variables in scope sc
+func evaluatePostfixIn(postfix []string, sc *scope) (int, error) {
+	stack := []int{}
+	// Unevaluated arguments of special forms, each one a postfix expression
+	thunks := [][]string{}
+	for i := 0; i < len(postfix); i++ {
+		if err := checkTimeout(); err != nil {
+			return 0, err
+		}
+		token := postfix[i]
+		if token == "[" {
+			end := matchingBracket(postfix, i)
+			thunks = append(thunks, postfix[i+1:end])
+			i = end
+			continue
+		}
+		if name, argc, ok := parseFuncToken(token); ok && isSpecialForm(name) {
+			if len(thunks) < argc {
 				return 0, fmt.Errorf("Invalid expression")
 			}
+			res, err := callSpecialForm(name, thunks[len(thunks)-argc:], sc)
+			if err != nil {
+				return 0, err
+			}
+			thunks = thunks[:len(thunks)-argc]
 			stack = append(stack, res)
+			continue
+		}
+		var err error
+		stack, err = applyToken(stack, token, sc)
+		if err != nil {
+			return 0, err
 		}
 	}
 	if len(stack) != 1 {
@@ -199,87 +591,835 @@ func evaluatePostfix(postfix []string) (int, error) {
 	return stack[0], nil
 }
 
-// Handle assignment
-func handleAssignment(line string) {
-	parts := strings.Split(line, "=")
-	if len(parts) != 2 {
-		fmt.Println("Invalid assignment")
-		return
+// Index of the "]" closing the "[" at postfix[start]
+func matchingBracket(postfix []string, start int) int {
+	depth := 0
+	for i := start; i < len(postfix); i++ {
+		switch postfix[i] {
+		case "[":
+			depth++
+		case "]":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
 	}
-	left := strings.TrimSpace(parts[0])
-	right := strings.TrimSpace(parts[1])
+	return len(postfix)
+}
 
-	if !isValidIdentifier(left) {
-		fmt.Println("Invalid identifier")
-		return
+// Apply one postfix token to the value stack: push an operand, or replace
+// the operands of an operator or function call with its result
+func applyToken(stack []int, token string, sc *scope) ([]int, error) {
+	if isNumber(token) || isValueName(token) {
+		val, err := resolveValue(token, sc)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, val)
+	} else if name, argc, ok := parseFuncToken(token); ok {
+		if len(stack) < argc {
+			return nil, fmt.Errorf("Invalid expression")
+		}
+		args := stack[len(stack)-argc:]
+		res, err := callFunction(name, args)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack[:len(stack)-argc], res)
+	} else if token == "!" {
+		if len(stack) < 1 {
+			return nil, fmt.Errorf("Invalid expression")
+		}
+		res, err := factorial(stack[len(stack)-1])
+		if err != nil {
+			return nil, err
+		}
+		stack[len(stack)-1] = res
+	} else if token == "%" {
+		if len(stack) < 1 {
+			return nil, fmt.Errorf("Invalid expression")
+		}
+		stack[len(stack)-1] /= 100
+	} else if token == "u-" || token == "u+" || token == "u~" || token == "u√" {
+		if len(stack) < 1 {
+			return nil, fmt.Errorf("Invalid expression")
+		}
+		switch token {
+		case "u-":
+			stack[len(stack)-1] = -stack[len(stack)-1]
+		case "u~":
+			stack[len(stack)-1] = ^stack[len(stack)-1]
+		case "u√":
+			a := stack[len(stack)-1]
+			if a < 0 {
+				return nil, fmt.Errorf("Math domain error")
+			}
+			stack[len(stack)-1] = isqrt(a)
+			guardPrecision(token, a, 0, stack[len(stack)-1])
+		}
+	} else {
+		if len(stack) < 2 {
+			return nil, fmt.Errorf("Invalid expression")
+		}
+		b := stack[len(stack)-1]
+		a := stack[len(stack)-2]
+		stack = stack[:len(stack)-2]
+		var res int
+		switch token {
+		case "+":
+			res = a + b
+		case "-":
+			res = a - b
+		case "*":
+			res = a * b
+		case "/":
+			if b == 0 {
+				return nil, fmt.Errorf("Division by zero")
+			}
+			// Integer division truncates toward zero: -7 / 2 is -3
+			res = a / b
+		case "//":
+			if b == 0 {
+				return nil, fmt.Errorf("Division by zero")
+			}
+			// Floor division rounds down: -7 // 2 is -4
+			res = a / b
+			if a%b != 0 && (a < 0) != (b < 0) {
+				res--
+			}
+		case "mod":
+			if b == 0 {
+				return nil, fmt.Errorf("Division by zero")
+			}
+			// The remainder of floor division, with the sign of b:
+			// -7 mod 3 is 2
+			res = a % b
+			if res != 0 && (res < 0) != (b < 0) {
+				res += b
+			}
+		case "+%":
+			res = a + a*b/100
+		case "-%":
+			res = a - a*b/100
+		case "*%":
+			res = a * b / 100
+		case "/%":
+			if b == 0 {
+				return nil, fmt.Errorf("Division by zero")
+			}
+			res = a * 100 / b
+		case "⊕":
+			res = a ^ b
+		case "==":
+			res = boolToInt(a == b)
+		case "!=":
+			res = boolToInt(a != b)
+		case "<":
+			res = boolToInt(a < b)
+		case ">":
+			res = boolToInt(a > b)
+		case "<=":
+			res = boolToInt(a <= b)
+		case ">=":
+			res = boolToInt(a >= b)
+		case "^":
+			// 0^0 is 1 by convention, 0 to a negative power is undefined
+			if a == 0 && b < 0 {
+				return nil, fmt.Errorf("Math domain error")
+			}
+			if b == 0 {
+				res = 1
+			} else {
+				res = int(math.Pow(float64(a), float64(b)))
+			}
+		default:
+			c, ok := customOperators[token]
+			if !ok {
+				return nil, fmt.Errorf("Invalid expression")
+			}
+			var err error
+			if res, err = callUserFunction(c.fn, []int{a, b}); err != nil {
+				return nil, err
+			}
+		}
+		guardPrecision(token, a, b, res)
+		stack = append(stack, res)
 	}
+	return stack, nil
+}
 
-	if isNumber(right) {
-		val, _ := strconv.Atoi(right)
-		variables[left] = val
-		return
+// Comparison result: 1 for true, 0 for false
+func boolToInt(b bool) int {
+	if b {
+		return 1
 	}
-	if isValidIdentifier(right) {
-		val, ok := variables[right]
-		if !ok {
-			fmt.Println("Unknown variable")
-			return
+	return 0
+}
+
+// In strict mode = only updates existing variables, new ones need :=
+var strictMode = false
+
+// Handle assignment, including parallel assignment like a, b = b, a.
+// x := value declares x and fails if it exists; x = value creates x
+// unless strict mode is on.
+func handleAssignment(line string) error {
+	eq := assignmentIndex(line)
+	left, right := line[:eq], line[eq+1:]
+	if assignmentIndex(right) >= 0 {
+		return fmt.Errorf("Invalid assignment")
+	}
+	// x += value and the like update x with a binary operator
+	for _, op := range []string{"//", "**", "+", "-", "*", "/", "^"} {
+		if target, ok := strings.CutSuffix(left, op); ok {
+			return compoundAssignment(strings.TrimSpace(target), op, right)
 		}
-		variables[left] = val
-		return
 	}
-	fmt.Println("Invalid assignment")
+	// name := value declares a new variable
+	declare := strings.HasSuffix(left, ":")
+	left = strings.TrimSuffix(left, ":")
+	targets := strings.Split(left, ",")
+	sources := splitTopLevel(right, ',')
+	if len(targets) != len(sources) {
+		return fmt.Errorf("Invalid assignment")
+	}
+
+	for i := range targets {
+		targets[i] = strings.TrimSpace(targets[i])
+		if !isValidIdentifier(targets[i]) {
+			return fmt.Errorf("Invalid identifier")
+		}
+		if err := checkNotConstant(targets[i]); err != nil {
+			return err
+		}
+		_, exists := variables[targets[i]]
+		if declare && exists {
+			return fmt.Errorf("Variable already defined: %s", targets[i])
+		}
+		if strictMode && !declare && !exists {
+			return unknownVariableError{targets[i]}
+		}
+	}
+
+	// Evaluate every value before assigning any, so a, b = b, a swaps and
+	// a failing right-hand side leaves all variables unchanged
+	values := make([]int, len(sources))
+	for i, source := range sources {
+		val, err := assignmentValue(strings.TrimSpace(source))
+		if err != nil {
+			return err
+		}
+		values[i] = val
+	}
+	for i, target := range targets {
+		variables[target] = values[i]
+	}
+	variablesChanged(targets...)
+	return nil
 }
 
-func main() {
-	scanner := bufio.NewScanner(os.Stdin)
+// Handle x op= value, like x += 1 or x //= 2. An undefined x counts as 0
+// and is created, unless strict mode is on.
+func compoundAssignment(target, op, right string) error {
+	if !isValidIdentifier(target) {
+		return fmt.Errorf("Invalid identifier")
+	}
+	if err := checkNotConstant(target); err != nil {
+		return err
+	}
+	current, exists := variables[target]
+	if strictMode && !exists {
+		return unknownVariableError{target}
+	}
+	val, err := assignmentValue(strings.TrimSpace(right))
+	if err != nil {
+		return err
+	}
+	// Operators are spelled as in infixToPostfix output
+	if op == "**" {
+		op = "^"
+	} else if op == "^" && operatorMode == "c" {
+		op = "⊕"
+	}
+	stack, err := applyToken([]int{current, val}, op, globalScope)
+	if err != nil {
+		return err
+	}
+	variables[target] = stack[0]
+	variablesChanged(target)
+	return nil
+}
 
-	for {
-		if !scanner.Scan() {
-			break
+// Split s around the last occurrence of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// Handle expr => name: print the value of expr and store it in name,
+// following the same rules as name = expr
+func handleCapture(expr, target string) error {
+	if !isValidIdentifier(target) {
+		return fmt.Errorf("Invalid identifier")
+	}
+	if err := checkNotConstant(target); err != nil {
+		return err
+	}
+	if _, exists := variables[target]; strictMode && !exists {
+		return unknownVariableError{target}
+	}
+	val, err := evaluate(expr)
+	if err != nil {
+		return err
+	}
+	variables[target] = val
+	printResult(val)
+	recordResult(val)
+	variablesChanged(target)
+	return nil
+}
+
+// Split off a trailing comment starting with # at the start of the line
+// or after white space, outside string literals. // is floor division,
+// so it cannot start comments. Function tokens like abs#1 are kept.
+func splitComment(line string) (string, string) {
+	quoted := false
+	for i, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '#' && !quoted && (i == 0 || unicode.IsSpace(rune(line[i-1]))):
+			return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
 		}
-		line := strings.TrimSpace(scanner.Text())
+	}
+	return line, ""
+}
 
-		if line == "/exit" {
-			fmt.Println("Bye!")
-			break
+// Attach the comment of an assignment line as note to the variables it
+// assigned. Without a comment their notes stay as they were.
+func annotate(line, comment string) {
+	if comment == "" {
+		return
+	}
+	left := strings.TrimRight(line[:assignmentIndex(line)], ":+-*/^ ")
+	for _, name := range strings.Split(left, ",") {
+		if name = strings.TrimSpace(name); isValidIdentifier(name) {
+			notes[name] = comment
 		}
-		if line == "/help" {
-			fmt.Println("The program supports +, -, *, /, ^ and parentheses ().")
-			fmt.Println("It also supports variables and unary minus.")
+	}
+}
+
+// Position of the assignment "=" in line, or -1 if there is none.
+// The "=" of comparison operators like == or <= does not count.
+func assignmentIndex(line string) int {
+	for i := 0; i < len(line); i++ {
+		if line[i] != '=' {
 			continue
 		}
-		if line == "" {
+		if i+1 < len(line) && line[i+1] == '=' {
+			i++
 			continue
 		}
-		if strings.HasPrefix(line, "/") {
-			fmt.Println("Unknown command")
+		if i > 0 && strings.ContainsRune("<>!", rune(line[i-1])) {
 			continue
 		}
-		if strings.Contains(line, "=") {
-			handleAssignment(line)
-			continue
+		return i
+	}
+	return -1
+}
+
+// Evaluate right-hand side of an assignment
+func assignmentValue(right string) (int, error) {
+	if right == "" {
+		return 0, fmt.Errorf("Invalid assignment")
+	}
+	postfix, err := infixToPostfix(right)
+	if errors.Is(err, errTooDeeplyNested) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Invalid assignment")
+	}
+	return evaluatePostfix(foldConstants(postfix))
+}
+
+// Split s at sep, ignoring separators nested inside parentheses
+func splitTopLevel(s string, sep rune) []string {
+	parts := []string{}
+	depth := 0
+	start := 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Check if line is a print statement rather than a use of a variable
+// named print, as in print = 3
+func isPrintStatement(line string) bool {
+	rest, ok := strings.CutPrefix(line, "print")
+	next, _ := utf8.DecodeRuneInString(rest)
+	if !ok || !(unicode.IsSpace(next) || next == '"') {
+		return false
+	}
+	rest = strings.TrimSpace(rest)
+	return !strings.HasPrefix(rest, "=") && !strings.HasPrefix(rest, ":=") && !strings.HasPrefix(rest, ",")
+}
+
+// Handle print "label", expr, ... printing string literals as they are and
+// the values of expressions, separated by spaces
+func handlePrint(args string) error {
+	parts := []string{}
+	rest := strings.TrimSpace(args)
+	for rest != "" {
+		var item string
+		if strings.HasPrefix(rest, "\"") {
+			end := strings.Index(rest[1:], "\"")
+			if end < 0 {
+				return fmt.Errorf("Unterminated string")
+			}
+			item, rest = rest[1:end+1], strings.TrimSpace(rest[end+2:])
+		} else {
+			expr := splitTopLevel(rest, ',')[0]
+			val, err := evaluate(expr)
+			if err != nil {
+				return err
+			}
+			item, rest = localize(strconv.Itoa(val)), strings.TrimSpace(rest[len(expr):])
 		}
-		if isValidIdentifier(line) {
-			val, ok := variables[line]
+		parts = append(parts, item)
+
+		// Items are separated by commas
+		if rest != "" {
+			after, ok := strings.CutPrefix(rest, ",")
 			if !ok {
-				fmt.Println("Unknown variable")
-			} else {
-				fmt.Println(val)
+				return fmt.Errorf("Invalid print statement")
+			}
+			rest = strings.TrimSpace(after)
+			if rest == "" {
+				return fmt.Errorf("Invalid print statement")
 			}
-			continue
 		}
+	}
+	fmt.Fprintln(out, strings.Join(parts, " "))
+	return nil
+}
+
+// Last expression entered, evaluated again by /redo
+var lastExpression = ""
 
-		postfix, err := infixToPostfix(line)
+// Process a single input line, printing its result.
+// Errors are returned to the caller instead of being printed.
+func processLine(line string) error {
+	line = normalizeWidth(line)
+	if line == "" {
+		return nil
+	}
+	evalDeadline = time.Now().Add(evalTimeout)
+	defer printPrecisionWarnings()
+	// Lines typed while recording a macro are stored, not executed
+	if recordingMacro != "" && line != "/macro stop" {
+		macros[recordingMacro] = append(macros[recordingMacro], line)
+		return nil
+	}
+	line, comment := splitComment(line)
+	if line == "" {
+		return nil
+	}
+	// A trailing ; runs the line without printing its output
+	if trimmed, ok := strings.CutSuffix(line, ";"); ok {
+		defer func(w io.Writer) { out = w }(out)
+		out = io.Discard
+		line = strings.TrimSpace(trimmed)
+		if line == "" {
+			return nil
+		}
+	}
+	if strings.HasPrefix(line, "/") {
+		return handleCommand(line)
+	}
+	// name? is short for /whatis name
+	if name, ok := strings.CutSuffix(line, "?"); ok && isValueName(strings.TrimSpace(name)) {
+		return whatis([]string{strings.TrimSpace(name)})
+	}
+	if dataMode {
+		return addData(line)
+	}
+	if rpnMode {
+		return evaluateRPN(line)
+	}
+	if isPrintStatement(line) {
+		return handlePrint(strings.TrimPrefix(line, "print"))
+	}
+	if expr, target, ok := cutLast(line, "=>"); ok {
+		return handleCapture(strings.TrimSpace(expr), strings.TrimSpace(target))
+	}
+	if name, expr, ok := splitLabel(line); ok {
+		return handleLabel(name, expr)
+	}
+	if assignmentIndex(line) >= 0 {
+		if err := handleAssignment(line); err != nil {
+			return err
+		}
+		annotate(line, comment)
+		return nil
+	}
+	lastExpression = line
+	if symbolicMode {
+		if printed, err := printSymbolic(line); printed {
+			return err
+		}
+	}
+	if isValueName(line) {
+		val, err := resolveValue(line, globalScope)
+		if err != nil {
+			return err
+		}
+		printResult(val)
+		recordResult(val)
+		return nil
+	}
+	// Comma-separated expressions print all their values on one line
+	if parts := splitTopLevel(line, ','); len(parts) > 1 {
+		vals := make([]int, len(parts))
+		for i, part := range parts {
+			val, err := evaluate(part)
+			if err != nil {
+				return err
+			}
+			vals[i] = val
+		}
+		printResults(vals)
+		for _, val := range vals {
+			recordResult(val)
+		}
+		return nil
+	}
+
+	if exactMode {
+		if printed, err := printExact(line); printed {
+			return err
+		}
+	}
+	result, err := evaluate(line)
+	if errors.Is(err, errNumberRange) {
+		if printed, err := printBigFactorial(line); printed {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	printResult(result)
+	recordResult(result)
+	if lintMode {
+		lint(line)
+	}
+	return nil
+}
+
+// Most recent error and the input line that caused it, for /last-error
+var (
+	lastError     error
+	lastErrorLine string
+)
+
+// Print the error of an input line and remember it
+func reportError(line string, err error) {
+	lastError, lastErrorLine = err, line
+	printError(err)
+}
+
+// Print the most recent error again, with its input line
+func showLastError() error {
+	if lastError == nil {
+		fmt.Fprintln(out, "No errors")
+		return nil
+	}
+	fmt.Fprintln(out, lastError)
+	fmt.Fprintln(out, "  in:", lastErrorLine)
+	return nil
+}
+
+// Longest time a single input line may take to evaluate, 0 for no limit
+var evalTimeout = 5 * time.Second
+
+// Time by which the current line must be done
+var evalDeadline time.Time
+
+// Check if the current line has run out of time
+func checkTimeout() error {
+	if evalTimeout > 0 && time.Now().After(evalDeadline) {
+		return fmt.Errorf("Evaluation timed out")
+	}
+	return nil
+}
+
+// Evaluate an infix expression
+func evaluate(expr string) (int, error) {
+	return evaluateIn(expr, globalScope)
+}
+
+// Evaluate an infix expression, resolving variables in scope sc
+func evaluateIn(expr string, sc *scope) (int, error) {
+	postfix, err := infixToPostfix(expr)
+	if errors.Is(err, errTooDeeplyNested) {
+		return 0, err
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Invalid expression")
+	}
+	return evaluatePostfixIn(foldConstants(postfix), sc)
+}
+
+// List of expressions given with repeated -e flags
+type exprList []string
+
+func (l *exprList) String() string {
+	return strings.Join(*l, "; ")
+}
+
+func (l *exprList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func main() {
+	var exprs exprList
+	flag.Var(&exprs, "e", "evaluate `expression` and exit (may be repeated)")
+	noRC := flag.Bool("no-rc", false, "do not run startup files")
+	flag.BoolVar(&quietMode, "q", false, "print only results and errors")
+	flag.Parse()
+
+	useColor = isTerminal(os.Stdout) && isTerminal(os.Stderr)
+
+	if !*noRC {
+		loadRCFiles()
+	}
+	loadEnvVariables()
+
+	// Evaluate -e expressions in order, sharing variables, then exit
+	if len(exprs) > 0 {
+		failed := false
+		for _, expr := range exprs {
+			if err := processLine(strings.TrimSpace(expr)); err != nil {
+				reportError(expr, err)
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Read lines from a script file if one is given, otherwise stdin
+	input := os.Stdin
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			printError(fmt.Errorf("Cannot open file"))
+			os.Exit(1)
+		}
+		input = f
+	}
+	interactive := input == os.Stdin && isTerminal(os.Stdin)
+
+	failed := run(input, interactive)
+	input.Close()
+	// Only scripts report errors through the exit code
+	if failed && !interactive {
+		os.Exit(1)
+	}
+}
+
+// Run startup files before any other input: ~/.smartcalcrc first, then
+// .calcrc in the current directory so local settings can override it.
+// Missing files are skipped silently.
+func loadRCFiles() {
+	paths := []string{}
+	if home, err := os.UserHomeDir(); err == nil {
+		paths = append(paths, filepath.Join(home, ".smartcalcrc"))
+	}
+	paths = append(paths, ".calcrc")
+
+	for _, path := range paths {
+		f, err := os.Open(path)
 		if err != nil {
-			fmt.Println("Invalid expression")
 			continue
 		}
-		result, err := evaluatePostfix(postfix)
+		run(f, false)
+		f.Close()
+	}
+}
+
+// Assign the variables listed in SMARTCALC_VARS, like "x=5;y=10".
+// Entries that fail only warn, so a bad one does not stop startup.
+func loadEnvVariables() {
+	for _, entry := range strings.Split(os.Getenv("SMARTCALC_VARS"), ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		err := fmt.Errorf("Invalid assignment")
+		if assignmentIndex(entry) >= 0 {
+			evalDeadline = time.Now().Add(evalTimeout)
+			err = handleAssignment(entry)
+		}
 		if err != nil {
-			fmt.Println("Invalid expression")
+			printError(fmt.Errorf("Warning: ignoring SMARTCALC_VARS entry %s: %v", entry, err))
+		}
+	}
+}
+
+// Check if file is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Process input lines until end of input or /exit.
+// In interactive mode an expression with unclosed parentheses continues on
+// the next line; an empty line or /cancel drops it. Scripts may use /quiet
+// and /verbose to turn their output off and on.
+// Returns true if any line produced an error.
+func run(r io.Reader, interactive bool) bool {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineLength)
+	lines := newLineSource(scanner, interactive)
+	failed := false
+	pending := ""
+	// Output silenced by /quiet comes back with /verbose or at the end
+	verbose := out
+	defer func() { out = verbose }()
+
+	for {
+		line, ok := lines.next()
+		if !ok {
+			break
+		}
+		line = strings.TrimSpace(line)
+
+		if pending != "" {
+			if line == "" || line == "/cancel" {
+				pending = ""
+				continue
+			}
+			line = pending + " " + line
+			pending = ""
+		}
+		if line == "/exit" {
+			printInfo("Bye!\n")
+			return failed
+		}
+		// Scripts can silence their output with /quiet until /verbose
+		if !interactive && (line == "/quiet" || line == "/verbose") {
+			if line == "/quiet" {
+				out = io.Discard
+			} else {
+				out = verbose
+			}
+			continue
+		}
+		if interactive && !strings.HasPrefix(line, "/") && parenBalance(line) > 0 {
+			pending = line
+			// No prompt while the rest of a paste is coming in
+			if !lines.waiting() {
+				printInfo("... ")
+			}
 			continue
 		}
-		fmt.Println(result)
+		if err := processLine(line); err != nil {
+			reportError(line, err)
+			failed = true
+		}
+	}
+	// The scanner is done here, also when it ran in the background
+	if err := scanner.Err(); err != nil {
+		printError(fmt.Errorf("Cannot read input"))
+		failed = true
+	}
+	return failed
+}
+
+// Time within which the next line of a paste arrives
+const pasteDelay = 20 * time.Millisecond
+
+// Input lines of a run. At the terminal lines are read in the background,
+// so that the next line can be looked at without blocking.
+type lineSource struct {
+	scanner *bufio.Scanner
+	lines   chan string // nil when reading directly from the scanner
+	held    []string    // lines received by waiting but not yet returned
+}
+
+func newLineSource(scanner *bufio.Scanner, background bool) *lineSource {
+	src := &lineSource{scanner: scanner}
+	if background {
+		src.lines = make(chan string)
+		go func() {
+			for scanner.Scan() {
+				src.lines <- scanner.Text()
+			}
+			close(src.lines)
+		}()
+	}
+	return src
+}
+
+// Next input line, false at the end of input
+func (src *lineSource) next() (string, bool) {
+	if len(src.held) > 0 {
+		line := src.held[0]
+		src.held = src.held[1:]
+		return line, true
 	}
+	if src.lines == nil {
+		if !src.scanner.Scan() {
+			return "", false
+		}
+		return src.scanner.Text(), true
+	}
+	line, ok := <-src.lines
+	return line, ok
+}
+
+// Check if another line is already waiting, as it is in the middle of a paste
+func (src *lineSource) waiting() bool {
+	if len(src.held) > 0 {
+		return true
+	}
+	if src.lines == nil {
+		return false
+	}
+	select {
+	case line, ok := <-src.lines:
+		if !ok {
+			return false
+		}
+		src.held = append(src.held, line)
+		return true
+	case <-time.After(pasteDelay):
+		return false
+	}
+}
+
+// Number of opening parentheses not yet closed
+func parenBalance(s string) int {
+	return strings.Count(s, "(") - strings.Count(s, ")")
 }
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Evaluate expr the way processLine does, with a fresh deadline
+func evalExpr(expr string) (int, error) {
+	evalDeadline = time.Now().Add(evalTimeout)
+	return evaluate(expr)
+}
+
+type evalCase struct {
+	expr string
+	want int
+}
+
+// Check that every expression evaluates to its expected value
+func checkEval(t *testing.T, cases []evalCase) {
+	t.Helper()
+	for _, c := range cases {
+		got, err := evalExpr(c.expr)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.expr, err)
+		} else if got != c.want {
+			t.Errorf("%q = %d, want %d", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestUnaryMinus(t *testing.T) {
+	checkEval(t, []evalCase{
+		{"-5", -5},
+		{"5-3", 2},
+		{"5 - 3", 2},
+		{"5 - -3", 8},
+		{"5--3", 8},
+		{"-(5)", -5},
+		{"-(-5)", 5},
+		{"2*-3", -6},
+		{"2 * -3", -6},
+		{"-2*3", -6},
+		{"2--3", 5},
+		{"2-+3", -1},
+		{"+5", 5},
+		{"-2^2", -4},
+		{"(-2)^2", 4},
+		{"2^-1", 0},
+		{"-2^-2", 0},
+		{"2^-0", 1},
+		{"-3!", -6},
+		{"-(2+3)*2", -10},
+		{"abs(-5)", 5},
+		{"max(-1, -2)", -1},
+	})
+}
+
+func TestAssociativity(t *testing.T) {
+	checkEval(t, []evalCase{
+		{"2 ^ 3 ^ 2", 512},
+		{"(2 ^ 3) ^ 2", 64},
+		{"2 ** 3 ** 2", 512},
+		{"10 - 5 - 2", 3},
+		{"10 - (5 - 2)", 7},
+		{"100 / 10 / 2", 5},
+		{"100 / (10 / 2)", 20},
+		{"2 * 3 / 4", 1},
+		{"2 / 3 * 4", 0},
+		{"20 // 3 // 2", 3},
+		{"20 mod 7 mod 4", 2},
+		{"1 - 2 + 3", 2},
+	})
+}
+
+// Check that every expression fails with the expected message
+func checkEvalError(t *testing.T, cases map[string]string) {
+	t.Helper()
+	for expr, want := range cases {
+		got, err := evalExpr(expr)
+		if err == nil {
+			t.Errorf("%q = %d, want error %q", expr, got, want)
+		} else if err.Error() != want {
+			t.Errorf("%q: error %q, want %q", expr, err, want)
+		}
+	}
+}
+
+func TestPowerEdgeCases(t *testing.T) {
+	checkEval(t, []evalCase{
+		{"0^0", 1},
+		{"0^1", 0},
+		{"5^0", 1},
+		{"(-5)^0", 1},
+		{"1^-1", 1},
+		{"(-1)^-1", -1},
+		{"(-1)^-2", 1},
+		{"2^-1", 0},
+	})
+	checkEvalError(t, map[string]string{
+		"0^-1":    "Math domain error",
+		"0^-2":    "Math domain error",
+		"0^(0-5)": "Math domain error",
+	})
+}
+
+// Set global variables for the duration of a test
+func setVariables(t *testing.T, vars map[string]int) {
+	t.Helper()
+	for name, value := range vars {
+		previous, existed := variables[name]
+		variables[name] = value
+		t.Cleanup(func() {
+			if existed {
+				variables[name] = previous
+			} else {
+				delete(variables, name)
+			}
+		})
+	}
+}
+
+func TestComparisonPrecedence(t *testing.T) {
+	setVariables(t, map[string]int{"x": 3, "y": -2})
+	checkEval(t, []evalCase{
+		{"(x > 0) + (y > 0)", 1},
+		{"(x > 0) + (y < 0)", 2},
+		{"(x == 3) * 10", 10},
+		{"x > 0 + 1", 1},
+		{"x > 2 + 1", 0},
+		{"x >= 2 + 1", 1},
+		{"x * 2 == 6", 1},
+		{"y < 0 - 1", 1},
+		{"1 + 1 != 2", 0},
+		{"x > 0 == 1", 1},
+	})
+}
+
+func TestSignSequences(t *testing.T) {
+	checkEval(t, []evalCase{
+		{"1 - - 2", 3},
+		{"1--2", 3},
+		{"1 -- 2", 3},
+		{"1 - -2", 3},
+		{"1- -2", 3},
+		{"1 + - 2", -1},
+		{"1+-2", -1},
+		{"1 - + 2", -1},
+		{"1-+2", -1},
+		{"1 + + 2", 3},
+		{"1 - - - 2", -1},
+		{"1---2", -1},
+		{"1 - - - - 2", 3},
+		{"- - 2", 2},
+		{"--2", 2},
+		{"-+-2", 2},
+		{"5 - 3 - 1", 1},
+		{"5 - -3", 8},
+		{"5 -	-3", 8},
+	})
+}
+
+func TestNegativeDivision(t *testing.T) {
+	checkEval(t, []evalCase{
+		{"-7 / 2", -3},
+		{"7 / -2", -3},
+		{"-7 / -2", 3},
+		{"7 / 2", 3},
+		{"-7 // 2", -4},
+		{"7 // -2", -4},
+		{"-7 // -2", 3},
+		{"7 // 2", 3},
+		{"-6 // 2", -3},
+	})
+	checkEvalError(t, map[string]string{
+		"1 / 0":  "Division by zero",
+		"1 // 0": "Division by zero",
+	})
+}
+
+func TestFunctionScope(t *testing.T) {
+	setVariables(t, map[string]int{"x": 1, "y": 100})
+	if err := defineFunction("f(x) = x + y"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { delete(userFunctions, "f") })
+	checkEval(t, []evalCase{
+		{"f(10)", 110},
+		{"f(x)", 101},
+		{"f(f(2))", 202},
+		{"f(10) + x", 111},
+	})
+	if variables["x"] != 1 {
+		t.Errorf("global x = %d after calling f, want 1", variables["x"])
+	}
+}
+
+func TestBitwiseNot(t *testing.T) {
+	checkEval(t, []evalCase{
+		{"~0", -1},
+		{"~5", -6},
+		{"~-1", 0},
+		{"~~7", 7},
+		{"-~0", 1},
+		{"~0 + 1", 0},
+		{"2 * ~1", -4},
+	})
+}
+
+func TestWhitespace(t *testing.T) {
+	checkEval(t, []evalCase{
+		{"2\t+\t3", 5},
+		{"2\n+\n3", 5},
+		{"\t 2 *\t(3\n+ 1) ", 8},
+		{"10\t//\t3", 3},
+		{"2\t**\t3", 8},
+		{"1\t<=\t2", 1},
+		{"max(\t1,\n2 )", 2},
+		{"5 -\t-3", 8},
+	})
+}
+
+func TestFactorial(t *testing.T) {
+	checkEval(t, []evalCase{
+		{"0!", 1},
+		{"5!", 120},
+		{"-3!", -6},
+		{"12!", 479001600},
+	})
+	checkEvalError(t, map[string]string{
+		"21!":     "Number out of range",
+		"(-1)!":   "Factorial of a negative number",
+		"30! + 1": "Number out of range",
+	})
+
+	saved := out
+	t.Cleanup(func() { out = saved })
+	for line, want := range map[string]string{
+		"20!":     "2432902008176640000",
+		"30!":     "265252859812191058636308480000000",
+		"(25+5)!": "265252859812191058636308480000000",
+	} {
+		var buf bytes.Buffer
+		out = &buf
+		if err := processLine(line); err != nil {
+			t.Errorf("%q: unexpected error: %v", line, err)
+		} else if got := strings.TrimSpace(buf.String()); got != want {
+			t.Errorf("%q printed %s, want %s", line, got, want)
+		}
+	}
+}
+
+func TestCustomOperatorConflicts(t *testing.T) {
+	for _, symbol := range []string{"<-", "*-", "--", "+-", "~~", "!*", "||", "|*", "<", "**"} {
+		if !conflictsWithBuiltin(symbol) {
+			t.Errorf("%s should conflict with built-in operators", symbol)
+		}
+	}
+	for _, symbol := range []string{"<>", "^^", "*/", "->", "@", ".+"} {
+		if conflictsWithBuiltin(symbol) {
+			t.Errorf("%s should not conflict with built-in operators", symbol)
+		}
+	}
+}
+
+func TestConstantCache(t *testing.T) {
+	clear(constantCache)
+	t.Cleanup(func() { clear(constantCache) })
+	setVariables(t, map[string]int{"x": 4})
+	checkEval(t, []evalCase{
+		{"2*3+4", 10},
+		{"2*3+4", 10},
+		{"x*(2+3)", 20},
+		{strings.Repeat("1+", 2000) + "1", 2001},
+	})
+	want := map[string]int{"2 3 * 4 +": 10, "2 3 +": 5}
+	if !maps.Equal(constantCache, want) {
+		t.Errorf("constantCache = %v, want %v", constantCache, want)
+	}
+	clear(constantCache)
+	checkEval(t, []evalCase{
+		{"x + 1 + (2 * 3) + max(x, 1 + 1) + -(2 - 3)", 16},
+		{"max(1 + 1, x * (2 + 3), 4 - 1) * 2", 40},
+	})
+	want = map[string]int{"2 3 *": 6, "1 1 +": 2, "2 3 - u-": 1, "2 3 +": 5, "4 1 -": 3}
+	if !maps.Equal(constantCache, want) {
+		t.Errorf("constantCache = %v, want %v", constantCache, want)
+	}
+	for i := range 2 * maxConstantCache {
+		evalExpr(strconv.Itoa(i) + "+1")
+	}
+	if len(constantCache) > maxConstantCache {
+		t.Errorf("constantCache has %d entries, want at most %d", len(constantCache), maxConstantCache)
+	}
+}
+
+// Folding must stay linear in the length of the expression, constant or not
+func TestFoldLongExpressions(t *testing.T) {
+	setVariables(t, map[string]int{"x": 2})
+	checkEval(t, []evalCase{
+		{strings.Repeat("1+", 100000) + "1", 100001},
+		{strings.Repeat("x+", 100000) + "x", 200002},
+		{strings.Repeat("x*1+", 100000) + "1", 200001},
+	})
+}
+
+func TestAbsBarsAndPipes(t *testing.T) {
+	checkEval(t, []evalCase{
+		{"|-3|>0", 1},
+		{"|-3|>=0", 1},
+		{"|-3|>=3", 1},
+		{"|-3|>3", 0},
+		{"|-3| > 0", 1},
+		{"||-3|-5|>1", 1},
+		{"|-3| |> abs", 3},
+		{"-16 |> abs", 16},
+		{"3 |> max(5)", 5},
+	})
+}
+
+func TestRPNSigns(t *testing.T) {
+	saved := out
+	out = io.Discard
+	t.Cleanup(func() { out, rpnStack = saved, nil })
+	for _, c := range []struct {
+		lines []string
+		want  []int
+	}{
+		{[]string{"5", "3 -4 +"}, []int{5, -1}},
+		{[]string{"5 neg"}, []int{-5}},
+		{[]string{"7 +2 -"}, []int{5}},
+		{[]string{"1 2", "-"}, []int{-1}},
+		{[]string{"3 4 -", "neg neg"}, []int{-1}},
+	} {
+		rpnStack = nil
+		for _, line := range c.lines {
+			if err := evaluateRPN(line); err != nil {
+				t.Errorf("%q: unexpected error: %v", line, err)
+			}
+		}
+		if !slices.Equal(rpnStack, c.want) {
+			t.Errorf("%q left %v, want %v", c.lines, rpnStack, c.want)
+		}
+	}
+}
+
+func TestSignedAssignment(t *testing.T) {
+	setVariables(t, map[string]int{"x": 0, "a": 0, "b": 0})
+	for _, c := range []struct {
+		line string
+		want map[string]int
+	}{
+		{"x = +5", map[string]int{"x": 5}},
+		{"x = -5", map[string]int{"x": -5}},
+		{"x=-5", map[string]int{"x": -5}},
+		{"x = - 5", map[string]int{"x": -5}},
+		{"x = -(2 + 3)", map[string]int{"x": -5}},
+		{"a, b = -1, +2", map[string]int{"a": -1, "b": 2}},
+		{"a, b = b, -a", map[string]int{"a": 2, "b": 1}},
+	} {
+		evalDeadline = time.Now().Add(evalTimeout)
+		if err := handleAssignment(c.line); err != nil {
+			t.Errorf("%q: unexpected error: %v", c.line, err)
+			continue
+		}
+		for name, want := range c.want {
+			if variables[name] != want {
+				t.Errorf("%q: %s = %d, want %d", c.line, name, variables[name], want)
+			}
+		}
+	}
+}
+
+// Lines far beyond bufio.Scanner's default 64 KB limit still evaluate
+func TestLongLines(t *testing.T) {
+	saved := out
+	t.Cleanup(func() { out = saved })
+	for _, c := range []struct {
+		line string
+		want string
+	}{
+		{strings.Repeat("1 + ", 100000) + "1", "100001"},
+		{strings.Repeat("2*1-1+", 100000) + "0", "100000"},
+		{strings.Repeat("(", 200) + "7" + strings.Repeat(")", 200) + strings.Repeat(" ", 300000), "7"},
+	} {
+		var buf bytes.Buffer
+		out = &buf
+		if failed := run(strings.NewReader(c.line+"\n"), false); failed {
+			t.Errorf("line of %d bytes failed", len(c.line))
+		} else if got := strings.TrimSpace(buf.String()); got != c.want {
+			t.Errorf("line of %d bytes printed %s, want %s", len(c.line), got, c.want)
+		}
+	}
+}
+
+func TestIntegrate(t *testing.T) {
+	saved := out
+	t.Cleanup(func() { out = saved })
+	for args, want := range map[string]string{
+		"x^2 x 0 3": "9",
+		"x^3 x 0 4": "64",
+		"x^3 x 0 5": "156.25",
+		"x x 0 1":   "0.5",
+		"x x 3 3":   "0",
+		"x^2 x 3 0": "-9",
+	} {
+		var buf bytes.Buffer
+		out = &buf
+		evalDeadline = time.Now().Add(evalTimeout)
+		if err := integrate(strings.Fields(args)); err != nil {
+			t.Errorf("/integrate %s: unexpected error: %v", args, err)
+		} else if got := strings.TrimSpace(buf.String()); got != want {
+			t.Errorf("/integrate %s printed %s, want %s", args, got, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Handle /topostfix <expr>: print the postfix form of expr without
+// evaluating it, in the notation /toinfix reads back. That is the
+// evaluator's own: 1 |> abs is 1 abs#1 and -2^2 is 2 2 ^ u-.
+func toPostfix(expr string) error {
+	postfix, err := infixToPostfix(expr)
+	if err != nil || len(postfix) == 0 {
+		return fmt.Errorf("Invalid expression")
+	}
+	fmt.Fprintln(out, strings.Join(postfix, " "))
+	return nil
+}
+
+// Infix text of a subexpression and how tightly its outermost operator
+// binds, atomPrecedence for numbers, names and calls
+type infixPart struct {
+	text string
+	prec int
+}
+
+// Binding of an operand that never needs parentheses
+const atomPrecedence = 100
+
+// Text of part, parenthesized if it binds looser than prec
+func wrap(part infixPart, prec int, strict bool) string {
+	if part.prec < prec || (strict && part.prec == prec) {
+		return "(" + part.text + ")"
+	}
+	return part.text
+}
+
+// Handle /toinfix <postfix>: rebuild the infix form of a postfix
+// expression written like /topostfix prints it, adding parentheses only
+// where precedence and associativity need them
+func toInfix(postfix string) error {
+	stack := []infixPart{}
+	for _, token := range strings.Fields(postfix) {
+		if isNumber(token) || isValueName(token) {
+			stack = append(stack, operandPart(token))
+			continue
+		}
+		argc, ok := operandCount(token)
+		if !ok {
+			return fmt.Errorf("Invalid token: %s", token)
+		}
+		if len(stack) < argc {
+			return fmt.Errorf("Invalid expression")
+		}
+		part := joinInfix(token, stack[len(stack)-argc:])
+		stack = append(stack[:len(stack)-argc], part)
+	}
+	if len(stack) != 1 {
+		return fmt.Errorf("Invalid expression")
+	}
+	fmt.Fprintln(out, stack[0].text)
+	return nil
+}
+
+// Infix part of a number or name. A negative number binds like a sign.
+func operandPart(token string) infixPart {
+	if strings.HasPrefix(token, "-") {
+		return infixPart{token, precedence("u-")}
+	}
+	return infixPart{token, atomPrecedence}
+}
+
+// Number of operands a postfix operator or function token takes, false if
+// it has no infix form
+func operandCount(token string) (int, bool) {
+	if name, argc, ok := parseFuncToken(token); ok {
+		return argc, !isSpecialForm(name)
+	}
+	switch {
+	case token == "u-" || token == "u+" || token == "u~" || token == "u√" || token == "!" || token == "%":
+		return 1, true
+	case token == "⊕":
+		return 2, operatorMode == "c"
+	case isOperator(token):
+		return 2, true
+	}
+	return 0, false
+}
+
+// Infix form of token applied to args, which must match operandCount
+func joinInfix(token string, args []infixPart) infixPart {
+	if name, _, ok := parseFuncToken(token); ok {
+		texts := make([]string, len(args))
+		for i, arg := range args {
+			texts[i] = arg.text
+		}
+		return infixPart{name + "(" + strings.Join(texts, ", ") + ")", atomPrecedence}
+	}
+	switch token {
+	case "u-", "u+", "u~", "u√":
+		return infixPart{token[1:] + wrap(args[0], precedence(token), false), precedence(token)}
+	case "!", "%":
+		return infixPart{wrap(args[0], atomPrecedence, false) + token, atomPrecedence}
+	case "+%", "-%", "*%", "/%":
+		prec := precedence(token)
+		text := wrap(args[0], prec, false) + " " + token[:1] + " " + wrap(args[1], atomPrecedence, false) + "%"
+		return infixPart{text, prec}
+	}
+	prec, right := precedence(token), isRightAssociative(token)
+	spelling := token
+	if token == "⊕" {
+		spelling = "^"
+	}
+	text := wrap(args[0], prec, right) + " " + spelling + " " + wrap(args[1], prec, !right)
+	return infixPart{text, prec}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ANSI escape sequences for colored output
+const (
+	colorGreen = "\x1b[32m"
+	colorRed   = "\x1b[31m"
+	colorReset = "\x1b[0m"
+)
+
+// Print results in green and errors in red. Enabled by default only when
+// output goes to a terminal.
+var useColor = false
+
+// Destination of results and other regular output. Scripts can discard
+// it with /quiet; errors are always printed, to stderr.
+var out io.Writer = os.Stdout
+
+// With -q only results and errors are printed, no messages or prompts
+var quietMode = false
+
+// Print a message that is not a result, like the goodbye on /exit
+func printInfo(msg string) {
+	if !quietMode {
+		fmt.Fprint(out, msg)
+	}
+}
+
+// Print a line of result text, colored like any result
+func printText(text string) {
+	if useColor {
+		fmt.Fprintln(out, colorGreen+text+colorReset)
+		return
+	}
+	fmt.Fprintln(out, text)
+}
+
+// Print the value of an expression or variable
+func printResult(val int) {
+	printText(localize(strconv.Itoa(val)))
+}
+
+// Print several values on one line, separated by spaces
+func printResults(vals []int) {
+	items := make([]string, len(vals))
+	for i, val := range vals {
+		items[i] = localize(strconv.Itoa(val))
+	}
+	printText(strings.Join(items, " "))
+}
+
+// Print num/den as a mixed number like 3 1/2, or 1/2 if it is below 1
+func printFraction(num, den int) {
+	text := fmt.Sprintf("%d/%d", num, den)
+	if whole := num / den; whole != 0 {
+		rest := num % den
+		if rest < 0 {
+			rest = -rest
+		}
+		text = fmt.Sprintf("%s %d/%d", localize(strconv.Itoa(whole)), rest, den)
+	}
+	printText(text)
+}
+
+// Print an error message to stderr, keeping stdout for results
+func printError(err error) {
+	if useColor {
+		fmt.Fprintln(os.Stderr, colorRed+err.Error()+colorReset)
+		return
+	}
+	fmt.Fprintln(os.Stderr, err)
+}
+
+// Rounding modes for decimal output: half-up rounds halves away from zero,
+// banker rounds them to the even digit, truncate drops extra digits
+var roundingModes = []string{"half-up", "banker", "truncate"}
+
+// Current rounding mode
+var roundingMode = "half-up"
+
+// Print decimals with full precision instead of rounding them
+var fullDecimals = false
+
+// Format x with at most places decimals, rounded with the current mode
+// and without trailing zeros. With /decimals full all digits are kept.
+func formatDecimal(x float64, places int) string {
+	if fullDecimals {
+		return localize(strconv.FormatFloat(x, 'f', -1, 64))
+	}
+	scale := math.Pow(10, float64(places))
+	switch roundingMode {
+	case "banker":
+		x = math.RoundToEven(x*scale) / scale
+	case "truncate":
+		x = math.Trunc(x*scale) / scale
+	default:
+		x = math.Round(x*scale) / scale
+	}
+	s := strconv.FormatFloat(x, 'f', places, 64)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return localize(s)
+}
+
+// Number formats of /locale: thousands separator and decimal point.
+// plain keeps digits ungrouped so results can be pasted back as input.
+var locales = map[string][2]string{
+	"plain": {"", "."},
+	"us":    {",", "."},
+	"de":    {".", ","},
+}
+
+// Current output locale
+var locale = "plain"
+
+// Format a number like -1234.5 for the current locale, e.g. -1.234,5 for de
+func localize(s string) string {
+	if locale == "plain" {
+		return s
+	}
+	sep := locales[locale]
+	sign, digits := "", s
+	if strings.HasPrefix(s, "-") {
+		sign, digits = "-", s[1:]
+	}
+	whole, frac, hasFrac := strings.Cut(digits, ".")
+	var sb strings.Builder
+	sb.WriteString(sign)
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			sb.WriteString(sep[0])
+		}
+		sb.WriteRune(d)
+	}
+	if hasFrac {
+		sb.WriteString(sep[1] + frac)
+	}
+	return sb.String()
+}
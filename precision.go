@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// With the precision guard on, divisions that drop a remainder and
+// operations that overflow int are reported after the line's output
+var precisionGuard = false
+
+// Lossy operations of the current line
+var precisionWarnings = []string{}
+
+// Handle /precision-guard on|off
+func setPrecisionGuard(args []string) error {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		return fmt.Errorf("Usage: /precision-guard on|off")
+	}
+	precisionGuard = args[0] == "on"
+	// Cached constants were computed without checking
+	clear(constantCache)
+	return nil
+}
+
+// Check a binary operation for lost precision and remember a warning
+func guardPrecision(op string, a, b, res int) {
+	if !precisionGuard {
+		return
+	}
+	lossy := ""
+	switch op {
+	case "/":
+		if a%b != 0 {
+			lossy = fmt.Sprintf("%d / %d truncated remainder %d", a, b, a%b)
+		}
+	case "+":
+		if (a > 0 && b > 0 && res < 0) || (a < 0 && b < 0 && res >= 0) {
+			lossy = fmt.Sprintf("%d + %d overflowed", a, b)
+		}
+	case "-":
+		if (a >= 0 && b < 0 && res < 0) || (a < 0 && b > 0 && res >= 0) {
+			lossy = fmt.Sprintf("%d - %d overflowed", a, b)
+		}
+	case "*":
+		if a != 0 && (res/a != b || (a == -1 && b == math.MinInt)) {
+			lossy = fmt.Sprintf("%d * %d overflowed", a, b)
+		}
+	case "u√":
+		if res*res != a {
+			lossy = fmt.Sprintf("√%d truncated to %d", a, res)
+		}
+	case "^":
+		if p := math.Pow(float64(a), float64(b)); p >= math.MaxInt || p < math.MinInt {
+			lossy = fmt.Sprintf("%d ^ %d overflowed", a, b)
+		} else if b < 0 && a != 1 && a != -1 {
+			lossy = fmt.Sprintf("%d ^ %d truncated", a, b)
+		}
+	}
+	if lossy != "" {
+		precisionWarnings = append(precisionWarnings, lossy)
+	}
+}
+
+// Print the warnings of the current line and forget them
+func printPrecisionWarnings() {
+	for _, warning := range precisionWarnings {
+		printInfo("Warning: " + warning + "\n")
+	}
+	precisionWarnings = precisionWarnings[:0]
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Memory registers r0 to r9, read as 0 until stored
+var registers [10]int
+
+// Register index of a name like r3, or -1 if it names no register
+func registerIndex(name string) int {
+	if len(name) == 2 && name[0] == 'r' && isDigit(name[1]) {
+		return int(name[1] - '0')
+	}
+	return -1
+}
+
+// Parse the register number argument of /sto and /rcl
+func registerArg(cmd string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("Usage: %s <0-9>", cmd)
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 || n >= len(registers) {
+		return 0, fmt.Errorf("Invalid register: %s", args[0])
+	}
+	return n, nil
+}
+
+// Handle /sto n: store the last result in register n
+func store(args []string) error {
+	n, err := registerArg("/sto", args)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("No previous result")
+	}
+	registers[n] = results[len(results)-1]
+	return nil
+}
+
+// Handle /rcl n: print register n and make it the last result
+func recall(args []string) error {
+	n, err := registerArg("/rcl", args)
+	if err != nil {
+		return err
+	}
+	printResult(registers[n])
+	recordResult(registers[n])
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// In RPN mode input lines are postfix, e.g. "3 4 +"
+var rpnMode = false
+
+// Values left by previous RPN lines, top of the stack last
+var rpnStack = []int{}
+
+// Handle /rpn [on|off]
+func setRPN(args []string) error {
+	if len(args) > 1 || (len(args) == 1 && args[0] != "on" && args[0] != "off") {
+		return fmt.Errorf("Usage: /rpn [on|off]")
+	}
+	rpnMode = len(args) == 0 || args[0] == "on"
+	return nil
+}
+
+// Print the RPN stack from bottom to top
+func showRPNStack() error {
+	if len(rpnStack) == 0 {
+		fmt.Fprintln(out, "Stack is empty")
+		return nil
+	}
+	values := make([]string, len(rpnStack))
+	for i, val := range rpnStack {
+		values[i] = strconv.Itoa(val)
+	}
+	fmt.Fprintln(out, strings.Join(values, " "))
+	return nil
+}
+
+// Apply a line of postfix tokens to the RPN stack and print the top value.
+// Tokens are separated by white space, so -4 is a negative number and
+// neg negates the top value. A failing line leaves the stack as it was.
+func evaluateRPN(line string) error {
+	stack := slices.Clone(rpnStack)
+	for _, token := range strings.Fields(line) {
+		if token == "neg" {
+			token = "u-"
+		}
+		var err error
+		stack, err = applyToken(stack, token, globalScope)
+		if err != nil {
+			return err
+		}
+	}
+	rpnStack = stack
+	if len(stack) > 0 {
+		printResult(stack[len(stack)-1])
+	}
+	return nil
+}
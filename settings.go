@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Current value of each setting for /get. /set name value runs the
+// command /name value, so both accept the same values.
+var settings = map[string]func() string{
+	"autosave": func() string {
+		if autosaveFile == "" {
+			return "off"
+		}
+		return "on " + autosaveFile
+	},
+	"color": func() string { return onOff(useColor) },
+	"data":  func() string { return onOff(dataMode) },
+	"decimals": func() string {
+		if fullDecimals {
+			return "full"
+		}
+		return "auto"
+	},
+	"exact":           func() string { return onOff(exactMode) },
+	"finance":         func() string { return onOff(financeMode) },
+	"limit":           func() string { return strconv.Itoa(iterationLimit) },
+	"lint":            func() string { return onOff(lintMode) },
+	"locale":          func() string { return locale },
+	"mode":            func() string { return operatorMode },
+	"nesting":         func() string { return strconv.Itoa(maxNesting) },
+	"precision-guard": func() string { return onOff(precisionGuard) },
+	"rounding":        func() string { return roundingMode },
+	"rpn":             func() string { return onOff(rpnMode) },
+	"strict":          func() string { return onOff(strictMode) },
+	"symbolic":        func() string { return onOff(symbolicMode) },
+	"timeout":         func() string { return strconv.Itoa(int(evalTimeout / time.Second)) },
+}
+
+// Spell a flag the way commands take it
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// Handle /set [name value...]: change a setting, or list all of them
+func set(args []string) error {
+	if len(args) == 0 {
+		names := make([]string, 0, len(settings))
+		for name := range settings {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(out, "%s = %s\n", name, settings[name]())
+		}
+		return nil
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("Usage: /set [<name> <value>]")
+	}
+	if _, ok := settings[args[0]]; !ok {
+		return fmt.Errorf("Unknown setting: %s", args[0])
+	}
+	return handleCommand("/" + strings.Join(args, " "))
+}
+
+// Handle /get <name>: print the value of a setting
+func get(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: /get <name>")
+	}
+	value, ok := settings[args[0]]
+	if !ok {
+		return fmt.Errorf("Unknown setting: %s", args[0])
+	}
+	fmt.Fprintln(out, value())
+	return nil
+}
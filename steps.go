@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Handle /steps <expr>: evaluate expr printing each operation in the
+// order it is computed, like "3 * 4 = 12" before "2 + 12 = 14"
+func showSteps(expr string) error {
+	if expr == "" {
+		return fmt.Errorf("Usage: /steps <expr>")
+	}
+	postfix, err := infixToPostfix(expr)
+	if err != nil {
+		return fmt.Errorf("Invalid expression")
+	}
+	stack := []int{}
+	thunks := [][]string{}
+	for i := 0; i < len(postfix); i++ {
+		if err := checkTimeout(); err != nil {
+			return err
+		}
+		token := postfix[i]
+		if token == "[" {
+			end := matchingBracket(postfix, i)
+			thunks = append(thunks, postfix[i+1:end])
+			i = end
+			continue
+		}
+		name, argc, isCall := parseFuncToken(token)
+		if isCall && isSpecialForm(name) {
+			if len(thunks) < argc {
+				return fmt.Errorf("Invalid expression")
+			}
+			res, err := callSpecialForm(name, thunks[len(thunks)-argc:], globalScope)
+			if err != nil {
+				return err
+			}
+			thunks = thunks[:len(thunks)-argc]
+			stack = append(stack, res)
+			fmt.Fprintf(out, "%s(...) = %d\n", name, res)
+			continue
+		}
+		before := stack
+		stack, err = applyToken(slices.Clone(stack), token, globalScope)
+		if err != nil {
+			return err
+		}
+		// Operands consumed by this token, to describe the step
+		used := before[len(before)-(len(before)-len(stack)+1):]
+		res := stack[len(stack)-1]
+		switch {
+		case isCall:
+			args := make([]string, len(used))
+			for j, val := range used {
+				args[j] = strconv.Itoa(val)
+			}
+			fmt.Fprintf(out, "%s(%s) = %d\n", name, strings.Join(args, ", "), res)
+		case token == "!":
+			fmt.Fprintf(out, "%d! = %d\n", used[0], res)
+		case isOperator(token):
+			spelling := token
+			if token == "⊕" {
+				spelling = "^"
+			}
+			fmt.Fprintf(out, "%d %s %d = %d\n", used[0], spelling, used[1], res)
+		}
+	}
+	if len(stack) != 1 {
+		return fmt.Errorf("Invalid expression")
+	}
+	printResult(stack[0])
+	recordResult(stack[0])
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// In symbolic mode an expression with undefined variables prints with
+// those variables left in, like 2 * x + 3, instead of failing
+var symbolicMode = false
+
+// Handle /symbolic on|off
+func setSymbolic(args []string) error {
+	if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+		return fmt.Errorf("Usage: /symbolic on|off")
+	}
+	symbolicMode = args[0] == "on"
+	return nil
+}
+
+// Subexpression during symbolic evaluation: a value if known, else text
+type symbolicPart struct {
+	infixPart
+	value int
+	known bool
+}
+
+// Evaluate expr keeping undefined variables as symbols. Every operator
+// and function works on symbols, parts without them are computed, so
+// 2 * 3 * x prints 6 * x. Special forms like sum() need defined values.
+// Reports false without printing if expr has no undefined variables.
+func printSymbolic(expr string) (bool, error) {
+	postfix, err := infixToPostfix(expr)
+	if err != nil {
+		return false, nil
+	}
+	stack := []symbolicPart{}
+	for _, token := range postfix {
+		if isNumber(token) || isValueName(token) {
+			val, err := resolveValue(token, globalScope)
+			var unknown unknownVariableError
+			if errors.As(err, &unknown) {
+				stack = append(stack, symbolicPart{infixPart: operandPart(token)})
+				continue
+			}
+			if err != nil {
+				return true, err
+			}
+			stack = append(stack, symbolicPart{operandPart(strconv.Itoa(val)), val, true})
+			continue
+		}
+		argc, ok := operandCount(token)
+		if !ok || len(stack) < argc {
+			return false, nil
+		}
+		args := stack[len(stack)-argc:]
+		known := true
+		parts := make([]infixPart, argc)
+		values := make([]int, argc)
+		for i, arg := range args {
+			known = known && arg.known
+			parts[i], values[i] = arg.infixPart, arg.value
+		}
+		part := symbolicPart{infixPart: joinInfix(token, parts)}
+		if known {
+			result, err := applyToken(values, token, globalScope)
+			if err != nil {
+				return true, err
+			}
+			part = symbolicPart{operandPart(strconv.Itoa(result[0])), result[0], true}
+		}
+		stack = append(stack[:len(stack)-argc], part)
+	}
+	if len(stack) != 1 || stack[0].known {
+		return false, nil
+	}
+	fmt.Fprintln(out, stack[0].text)
+	return true, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A unit as its size in the base unit of its dimension
+type unit struct {
+	dimension string
+	factor    float64
+}
+
+// Length in meters, mass in kilograms
+var units = map[string]unit{
+	"mm": {"length", 0.001},
+	"cm": {"length", 0.01},
+	"m":  {"length", 1},
+	"km": {"length", 1000},
+	"in": {"length", 0.0254},
+	"ft": {"length", 0.3048},
+	"yd": {"length", 0.9144},
+	"mi": {"length", 1609.344},
+	"mg": {"mass", 0.000001},
+	"g":  {"mass", 0.001},
+	"kg": {"mass", 1},
+	"t":  {"mass", 1000},
+	"oz": {"mass", 0.028349523125},
+	"lb": {"mass", 0.45359237},
+}
+
+// Temperature scales have offsets, so they convert through Celsius
+var temperatures = map[string]struct{ toC, fromC func(float64) float64 }{
+	"c": {func(x float64) float64 { return x }, func(x float64) float64 { return x }},
+	"f": {func(x float64) float64 { return (x - 32) * 5 / 9 }, func(x float64) float64 { return x*9/5 + 32 }},
+	"k": {func(x float64) float64 { return x - 273.15 }, func(x float64) float64 { return x + 273.15 }},
+}
+
+// Handle /convert <n> <from> <to> for units of length, mass and
+// temperature, like /convert 100 km mi
+func convertUnits(args []string) error {
+	val, err := evaluate(args[0])
+	if err != nil {
+		return err
+	}
+	from, to := strings.ToLower(args[1]), strings.ToLower(args[2])
+	x := float64(val)
+
+	tFrom, okFrom := temperatures[from]
+	tTo, okTo := temperatures[to]
+	if okFrom && okTo {
+		fmt.Fprintln(out, formatDecimal(tTo.fromC(tFrom.toC(x)), 2))
+		return nil
+	}
+	if okFrom || okTo {
+		return fmt.Errorf("Cannot convert %s to %s", args[1], args[2])
+	}
+	uFrom, okFrom := units[from]
+	uTo, okTo := units[to]
+	if !okFrom {
+		return fmt.Errorf("Unknown unit: %s", args[1])
+	}
+	if !okTo {
+		return fmt.Errorf("Unknown unit: %s", args[2])
+	}
+	if uFrom.dimension != uTo.dimension {
+		return fmt.Errorf("Cannot convert %s to %s", args[1], args[2])
+	}
+	fmt.Fprintln(out, formatDecimal(x*uFrom.factor/uTo.factor, 2))
+	return nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Expression printed again whenever a variable it reads changes
+type watch struct {
+	expr string
+	deps []string
+}
+
+// Watched expressions by name
+var watches = make(map[string]watch)
+
+// Handle /watch name = expr: print expr now and after every assignment to
+// a variable it reads. /watch alone lists the watches.
+func addWatch(def string) error {
+	if def == "" {
+		names := make([]string, 0, len(watches))
+		for name := range watches {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(out, "%s = %s\n", name, watches[name].expr)
+		}
+		return nil
+	}
+	name, expr, found := strings.Cut(def, "=")
+	name, expr = strings.TrimSpace(name), strings.TrimSpace(expr)
+	if !found || !isValidIdentifier(name) || expr == "" {
+		return fmt.Errorf("Usage: /watch name = expression")
+	}
+	postfix, err := infixToPostfix(expr)
+	if err != nil {
+		return fmt.Errorf("Invalid expression")
+	}
+	deps := []string{}
+	for _, token := range postfix {
+		if isValidIdentifier(token) && !slices.Contains(deps, token) {
+			deps = append(deps, token)
+		}
+	}
+	watches[name] = watch{expr, deps}
+	showWatch(name)
+	return nil
+}
+
+// Handle /unwatch name
+func removeWatch(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Usage: /unwatch <name>")
+	}
+	if _, ok := watches[args[0]]; !ok {
+		return fmt.Errorf("No such watch: %s", args[0])
+	}
+	delete(watches, args[0])
+	return nil
+}
+
+// Print the current value of a watch, or why it has none
+func showWatch(name string) {
+	val, err := evaluate(watches[name].expr)
+	if err != nil {
+		printError(fmt.Errorf("%s: %v", name, err))
+		return
+	}
+	fmt.Fprintf(out, "%s = %s\n", name, localize(fmt.Sprint(val)))
+}
+
+// Record that the named variables were assigned, or that any may have
+// changed if no names are given: autosave and print affected watches
+func variablesChanged(names ...string) {
+	autosave()
+	affected := []string{}
+	for name, w := range watches {
+		if len(names) == 0 || slices.ContainsFunc(names, func(n string) bool { return slices.Contains(w.deps, n) }) {
+			affected = append(affected, name)
+		}
+	}
+	sort.Strings(affected)
+	for _, name := range affected {
+		showWatch(name)
+	}
+}